@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runConnections opens total short sessions with the given concurrency, first straight to the
+// sink and then through the gateway, and reports allocations per connection. The direct run
+// covers the client and the sink, the difference to it is what the gateway allocates.
+func runConnections(total, concurrency int) error {
+	sinkAddr, received, closeSink, err := startSink()
+	if err != nil {
+		return err
+	}
+	defer closeSink()
+	go func() {
+		for range received {
+		}
+	}()
+
+	gw, err := startGateway("gateway", sinkAddr, 0)
+	if err != nil {
+		return err
+	}
+	defer gw.close()
+
+	fmt.Printf("%-10s %12s %12s %14s %14s\n", "target", "conns", "conns/s", "allocs/conn", "bytes/conn")
+	for _, r := range []relay{{name: "direct", addr: sinkAddr}, gw} {
+		if err := connections(r, total, concurrency); err != nil {
+			return fmt.Errorf("%s: %w", r.name, err)
+		}
+	}
+	return nil
+}
+
+func connections(r relay, total, concurrency int) error {
+	goroutines := runtime.NumGoroutine()
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	var next, failed atomic.Int64
+	var firstErr atomic.Value
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next.Add(1) <= int64(total) {
+				if err := stream(r.addr, 0); err != nil {
+					failed.Add(1)
+					firstErr.CompareAndSwap(nil, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	duration := time.Since(start)
+
+	// Let the relay finish closing its sessions before counting
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	runtime.ReadMemStats(&after)
+
+	if failed.Load() > 0 {
+		return fmt.Errorf("%d connections failed, first error: %w", failed.Load(), firstErr.Load().(error))
+	}
+	fmt.Printf("%-10s %12d %12.0f %14.1f %14.0f\n", r.name, total, float64(total)/duration.Seconds(),
+		float64(after.Mallocs-before.Mallocs)/float64(total), float64(after.TotalAlloc-before.TotalAlloc)/float64(total))
+	return nil
+}
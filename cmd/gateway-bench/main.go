@@ -0,0 +1,275 @@
+// Command gateway-bench measures forwarding throughput and CPU usage on loopback, or with
+// -mode connections the allocations per connection under many short sessions.
+//
+// It streams data from a client through a relay to a sink backend: a reference relay that
+// copies through a user space buffer, as the gateway did whenever a reader wrapped the client
+// connection, and the gateway with and without an idle timeout. CPU time covers the whole
+// process, client and sink included, so the difference between the runs is the cost of the relay.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/gateway"
+	"github.com/SmallL-U/minecraft-gateway/internal/logx"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+const (
+	benchHost            = "bench.local"
+	benchProtocolVersion = 763
+	chunkSize            = 64 * 1024
+)
+
+// relay is a forwarding implementation under test, listening on its own address.
+type relay struct {
+	name  string
+	addr  string
+	close func()
+}
+
+type result struct {
+	bytes    int64
+	duration time.Duration
+	cpu      time.Duration
+}
+
+func main() {
+	mode := flag.String("mode", "throughput", "throughput or connections")
+	size := flag.Int("size", 1024, "megabytes sent per connection")
+	conns := flag.Int("conns", 1, "parallel connections")
+	total := flag.Int("connections", 20000, "connections opened in connections mode")
+	flag.Parse()
+
+	if err := logx.Configure(logx.Options{Level: "warn", AccessLevel: "warn", Output: logx.OutputStderr}); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to configure logging: %v\n", err)
+		os.Exit(1)
+	}
+
+	var err error
+	switch *mode {
+	case "throughput":
+		err = run(int64(*size)<<20, *conns)
+	case "connections":
+		err = runConnections(*total, *conns)
+	default:
+		err = fmt.Errorf("unknown mode %q", *mode)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Benchmark failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(size int64, conns int) error {
+	sinkAddr, received, closeSink, err := startSink()
+	if err != nil {
+		return err
+	}
+	defer closeSink()
+
+	userspace, err := startUserspaceRelay(sinkAddr)
+	if err != nil {
+		return err
+	}
+	defer userspace.close()
+	gw, err := startGateway("gateway", sinkAddr, 0)
+	if err != nil {
+		return err
+	}
+	defer gw.close()
+	gwIdle, err := startGateway("gateway+idle", sinkAddr, time.Minute)
+	if err != nil {
+		return err
+	}
+	defer gwIdle.close()
+
+	fmt.Printf("%-14s %12s %12s %12s\n", "relay", "MB/s", "CPU", "CPU/GB")
+	for _, r := range []relay{userspace, gw, gwIdle} {
+		res, err := measure(r.addr, size, conns, received)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.name, err)
+		}
+		mb := float64(res.bytes) / (1 << 20)
+		perGB := time.Duration(float64(res.cpu) / (mb / 1024))
+		fmt.Printf("%-14s %12.1f %12s %12s\n", r.name, mb/res.duration.Seconds(), res.cpu.Round(time.Millisecond), perGB.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// measure streams size bytes over each of conns connections and waits until the sink got them.
+func measure(addr string, size int64, conns int, received <-chan int64) (result, error) {
+	cpuStart := cpuTime()
+	start := time.Now()
+
+	errs := make(chan error, conns)
+	var wg sync.WaitGroup
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- stream(addr, size)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return result{}, err
+		}
+	}
+
+	var total int64
+	for i := 0; i < conns; i++ {
+		total += <-received
+	}
+	return result{bytes: total, duration: time.Since(start), cpu: cpuTime() - cpuStart}, nil
+}
+
+// stream logs in like a client would and sends size bytes of payload.
+func stream(addr string, size int64) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	handshake := &protocol.HandshakePacket{
+		ProtocolVersion: benchProtocolVersion,
+		ServerAddress:   benchHost,
+		ServerPort:      25565,
+		NextState:       2,
+	}
+	if _, err := conn.Write(handshake.Encode()); err != nil {
+		return err
+	}
+	// Login start: player name followed by the UUID sent by 1.19.3+ clients
+	name := "bench"
+	loginStart := append([]byte{byte(len(name))}, name...)
+	loginStart = append(loginStart, make([]byte, 16)...)
+	if err := protocol.WritePacket(conn, 0x00, loginStart); err != nil {
+		return err
+	}
+
+	var chunk []byte
+	if size > 0 {
+		chunk = make([]byte, chunkSize)
+	}
+	for sent := int64(0); sent < size; sent += chunkSize {
+		if _, err := conn.Write(chunk[:min(chunkSize, size-sent)]); err != nil {
+			return err
+		}
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.CloseWrite()
+	}
+	// Wait for the relay to close once the sink has read everything
+	_, err = io.Copy(io.Discard, conn)
+	return err
+}
+
+// startSink starts a backend that discards everything and reports how many bytes each
+// connection delivered.
+func startSink() (string, <-chan int64, func(), error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	received := make(chan int64, 1024)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				n, _ := io.Copy(io.Discard, conn)
+				_ = conn.Close()
+				received <- n
+			}()
+		}
+	}()
+	return listener.Addr().String(), received, func() { _ = listener.Close() }, nil
+}
+
+// startUserspaceRelay starts a relay that copies through a buffer in user space. The connections
+// are wrapped to hide ReadFrom and WriteTo, which is what any reader between them does.
+func startUserspaceRelay(backendAddr string) (relay, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return relay{}, err
+	}
+	go func() {
+		for {
+			clientConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() {
+					_ = clientConn.Close()
+				}()
+				backendConn, err := net.Dial("tcp", backendAddr)
+				if err != nil {
+					return
+				}
+				defer func() {
+					_ = backendConn.Close()
+				}()
+				go func() {
+					_, _ = io.CopyBuffer(struct{ io.Writer }{clientConn}, struct{ io.Reader }{backendConn}, make([]byte, chunkSize))
+				}()
+				_, _ = io.CopyBuffer(struct{ io.Writer }{backendConn}, struct{ io.Reader }{clientConn}, make([]byte, chunkSize))
+				_ = backendConn.(*net.TCPConn).CloseWrite()
+				_, _ = io.Copy(io.Discard, backendConn)
+			}()
+		}
+	}()
+	return relay{name: "userspace", addr: listener.Addr().String(), close: func() { _ = listener.Close() }}, nil
+}
+
+// startGateway starts the gateway with a single server routed to the sink.
+func startGateway(name, backendAddr string, idleTimeout time.Duration) (relay, error) {
+	dir, err := os.MkdirTemp("", "gateway-bench")
+	if err != nil {
+		return relay{}, err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "config.yml")
+	data := fmt.Sprintf("listen_addr: \"127.0.0.1:0\"\ndefault: %q\nidle_timeout: %s\nlog_level: warn\nwhitelist: [\"0.0.0.0/0\", \"::/0\"]\nservers:\n  - name: %s\n    address: %q\n",
+		backendAddr, idleTimeout, benchHost, backendAddr)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		return relay{}, err
+	}
+	conf, err := config.LoadConfig(path)
+	if err != nil {
+		return relay{}, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return relay{}, err
+	}
+	gw := gateway.NewGateway(conf)
+	go func() {
+		if err := gw.Serve(context.Background(), listener); err != nil && !errors.Is(err, gateway.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "Gateway stopped: %v\n", err)
+		}
+	}()
+	return relay{name: name, addr: listener.Addr().String(), close: func() { _ = gw.Shutdown(context.Background()) }}, nil
+}
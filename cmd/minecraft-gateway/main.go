@@ -1,19 +1,106 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"time"
 
-	"minecraft-gateway/internal/config"
-	"minecraft-gateway/internal/gateway"
-	"minecraft-gateway/internal/logx"
-	"minecraft-gateway/internal/proc"
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/gateway"
+	"github.com/SmallL-U/minecraft-gateway/internal/logx"
+	"github.com/SmallL-U/minecraft-gateway/internal/proc"
+	"github.com/SmallL-U/minecraft-gateway/internal/tracing"
 )
 
 const configFile = "config.yml"
 
+// Maintenance flags set by the maintenance command, they override the config
+const maintenanceFile = "maintenance.yml"
+
 var gw *gateway.Gateway
 var logger = logx.GetLogger()
 
+// Shuts down the tracer provider installed by the last applyConfig call
+var shutdownTracing tracing.ShutdownFunc
+
+const tracingShutdownTimeout = 5 * time.Second
+
+// Grace period for established sessions when the gateway stops
+const gatewayShutdownTimeout = 5 * time.Second
+
+// applyConfig applies the logging and tracing settings of the given config, it is also used on
+// reload. Both are set up before either is applied, so a failure leaves the running ones in place.
+func applyConfig(conf *config.Config) error {
+	logging, err := logx.Prepare(logx.Options{
+		Level:       conf.LogLevel,
+		AccessLevel: conf.Logging.AccessLevel,
+		Format:      conf.Logging.Format,
+		Output:      conf.Logging.Output,
+		Rotation:    rotationOptions(conf.Logging.Rotation),
+		Access: logx.AccessOptions{
+			Format:   conf.Logging.AccessLog.Format,
+			Output:   conf.Logging.AccessLog.Output,
+			Rotation: rotationOptions(conf.Logging.AccessLog.Rotation),
+		},
+		Sampling: logx.SamplingOptions{
+			Limit:    conf.Logging.Sampling.Limit,
+			Interval: conf.Logging.Sampling.Interval,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("logging: %w", err)
+	}
+	provider, shutdown, err := tracing.New(context.Background(), tracing.Options{
+		Enabled:     conf.Tracing.Enabled,
+		Exporter:    conf.Tracing.Exporter,
+		Endpoint:    conf.Tracing.Endpoint,
+		Insecure:    conf.Tracing.Insecure,
+		SampleRatio: *conf.Tracing.SampleRatio,
+		ServiceName: conf.Tracing.ServiceName,
+	})
+	if err != nil {
+		logging.Discard()
+		return fmt.Errorf("tracing: %w", err)
+	}
+
+	logging.Apply()
+	tracing.Install(provider)
+	previous := shutdownTracing
+	shutdownTracing = shutdown
+	if previous != nil {
+		go stopTracing(previous)
+	}
+	return nil
+}
+
+func stopTracing(shutdown tracing.ShutdownFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		logger.Warnf("Failed to flush traces: %v", err)
+	}
+}
+
+// stopGateway stops accepting connections and waits a moment for established sessions to end.
+func stopGateway() {
+	ctx, cancel := context.WithTimeout(context.Background(), gatewayShutdownTimeout)
+	defer cancel()
+	if err := gw.Shutdown(ctx); err != nil {
+		logger.Warnf("Sessions still open after %s, closing them: %v", gatewayShutdownTimeout, err)
+	}
+}
+
+func rotationOptions(rotation config.RotationConfig) logx.RotationOptions {
+	return logx.RotationOptions{
+		MaxSize:    rotation.MaxSize,
+		Interval:   rotation.Interval,
+		MaxBackups: rotation.MaxBackups,
+		MaxAge:     rotation.MaxAge,
+	}
+}
+
 func handleReload() {
 	if err := proc.SendReload(); err != nil {
 		logger.Fatalf("Failed to send reload signal: %v", err)
@@ -21,6 +108,45 @@ func handleReload() {
 	logger.Info("Reload signal sent successfully")
 }
 
+// applyMaintenance loads the maintenance flags set at runtime into the gateway.
+func applyMaintenance() error {
+	state, err := config.LoadMaintenanceState(maintenanceFile)
+	if err != nil {
+		return err
+	}
+	gw.SetMaintenance(state)
+	return nil
+}
+
+// handleMaintenance turns maintenance of a server on or off and tells the running instance.
+func handleMaintenance(args []string) {
+	if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+		logger.Fatal("Usage: minecraft-gateway maintenance <server> on|off")
+	}
+	serverName, enabled := args[0], args[1] == "on"
+
+	conf, err := config.LoadConfig(configFile)
+	if err != nil {
+		logger.Fatalf("Failed to load config: %v", err)
+	}
+	if !conf.HasServer(serverName) {
+		logger.Fatalf("Unknown server: %s", serverName)
+	}
+	state, err := config.LoadMaintenanceState(maintenanceFile)
+	if err != nil {
+		logger.Fatalf("Failed to load maintenance state: %v", err)
+	}
+	state[serverName] = enabled
+	if err := config.SaveMaintenanceState(maintenanceFile, state); err != nil {
+		logger.Fatalf("Failed to save maintenance state: %v", err)
+	}
+	if err := proc.SendMaintenance(); err != nil {
+		logger.Warnf("Maintenance state saved, it applies when the gateway starts: %v", err)
+		return
+	}
+	logger.Infof("Maintenance of %s turned %s", serverName, args[1])
+}
+
 func handleStop() {
 	if err := proc.SendStop(); err != nil {
 		logger.Fatalf("Failed to send stop signal: %v", err)
@@ -44,21 +170,27 @@ func runServer() {
 	if err != nil {
 		logger.Fatalf("Failed to load config: %v", err)
 	}
-	if err := logx.SetLevel(conf.LogLevel); err != nil {
-		logger.Fatalf("Failed to apply log level %q: %v", conf.LogLevel, err)
+	if err := applyConfig(conf); err != nil {
+		logger.Fatalf("Failed to apply config: %v", err)
 	}
+	defer func() {
+		stopTracing(shutdownTracing)
+	}()
 	logger.Infof("Loaded config with %d servers", len(conf.Servers))
 
 	// New instance of gateway
 	gw = gateway.NewGateway(conf)
 	logger.Info("Created new minecraft gateway")
+	if err := applyMaintenance(); err != nil {
+		logger.Fatalf("Failed to apply maintenance state: %v", err)
+	}
 
 	errChan := make(chan error, 1)
 	doneChan := make(chan struct{})
 
 	// Start the gateway in a goroutine
 	go func() {
-		if err := gw.Start(); err != nil {
+		if err := gw.ListenAndServe(context.Background()); err != nil && !errors.Is(err, gateway.ErrServerClosed) {
 			errChan <- err
 		}
 	}()
@@ -80,6 +212,8 @@ func printUsage() {
 	logger.Info("  (none)    Start the gateway server")
 	logger.Info("  reload    Reload configuration (send SIGHUP to running instance)")
 	logger.Info("  stop      Stop the running instance (send SIGTERM)")
+	logger.Info("  maintenance <server> on|off")
+	logger.Info("            Turn maintenance of a server on or off (send SIGUSR1)")
 }
 
 func main() {
@@ -97,6 +231,8 @@ func main() {
 		handleReload()
 	case "stop":
 		handleStop()
+	case "maintenance":
+		handleMaintenance(os.Args[2:])
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -7,22 +7,20 @@ import (
 	"os/signal"
 	"syscall"
 
-	"minecraft-gateway/internal/config"
-	"minecraft-gateway/internal/logx"
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/logx"
 )
 
 func signalHandler(doneChan chan struct{}) {
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
 
 	for sig := range sigChan {
 		logger := logx.GetLogger()
 		switch sig {
 		case syscall.SIGINT, syscall.SIGTERM:
 			logger.Info("Received termination signal, shutting down...")
-			if err := gw.Stop(); err != nil {
-				logger.Warnf("Failed to shut down gateway: %s", err)
-			}
+			stopGateway()
 			close(doneChan)
 			return
 		case syscall.SIGHUP:
@@ -32,12 +30,17 @@ func signalHandler(doneChan chan struct{}) {
 				logger.Errorf("Failed to reload config: %v", err)
 				continue
 			}
-			if err := logx.SetLevel(newConf.LogLevel); err != nil {
-				logger.Errorf("Failed to apply log level %q: %v", newConf.LogLevel, err)
+			if err := applyConfig(newConf); err != nil {
+				logger.Errorf("Failed to apply config: %v", err)
 				continue
 			}
 			gw.UpdateConfig(newConf)
 			logger.Infof("Configuration reloaded successfully with %d servers", len(newConf.Servers))
+		case syscall.SIGUSR1:
+			logger.Info("Received SIGUSR1 signal, reloading maintenance state...")
+			if err := applyMaintenance(); err != nil {
+				logger.Errorf("Failed to apply maintenance state: %v", err)
+			}
 		default:
 			logger.Warnf("Received unknown signal: %v", sig)
 		}
@@ -3,9 +3,9 @@
 package main
 
 import (
-	"minecraft-gateway/internal/config"
-	"minecraft-gateway/internal/logx"
-	"minecraft-gateway/internal/proc"
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/logx"
+	"github.com/SmallL-U/minecraft-gateway/internal/proc"
 )
 
 func signalHandler(doneChan chan struct{}) {
@@ -21,9 +21,7 @@ func signalHandler(doneChan chan struct{}) {
 		switch sig {
 		case "stop":
 			logger.Info("Received stop signal, shutting down...")
-			if err := gw.Stop(); err != nil {
-				logger.Warnf("Failed to shut down gateway: %s", err)
-			}
+			stopGateway()
 			close(doneChan)
 			return
 		case "reload":
@@ -33,12 +31,17 @@ func signalHandler(doneChan chan struct{}) {
 				logger.Errorf("Failed to reload config: %v", err)
 				continue
 			}
-			if err := logx.SetLevel(newConf.LogLevel); err != nil {
-				logger.Errorf("Failed to apply log level %q: %v", newConf.LogLevel, err)
+			if err := applyConfig(newConf); err != nil {
+				logger.Errorf("Failed to apply config: %v", err)
 				continue
 			}
 			gw.UpdateConfig(newConf)
 			logger.Infof("Configuration reloaded successfully with %d servers", len(newConf.Servers))
+		case "maintenance":
+			logger.Info("Received maintenance signal, reloading maintenance state...")
+			if err := applyMaintenance(); err != nil {
+				logger.Errorf("Failed to apply maintenance state: %v", err)
+			}
 		}
 	}
 }
@@ -4,38 +4,213 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/goccy/go-yaml"
 )
 
-const defaultLogLevel = "info"
+const (
+	defaultLogLevel  = "info"
+	defaultLogFormat = "console"
+	defaultLogOutput = "stdout"
+
+	defaultHandshakeTimeout = 10 * time.Second
+	defaultMaxHandshakes    = 4096
+
+	defaultDialAttempts       = 1
+	defaultDialBackoff        = 100 * time.Millisecond
+	defaultBreakerCooldown    = 30 * time.Second
+	defaultUnavailableMessage = "The server is currently unavailable, please try again later."
+	defaultStatusCacheTTL     = 5 * time.Second
+
+	LegacyPingRespond = "respond"
+	LegacyPingForward = "forward"
+	LegacyPingDrop    = "drop"
+
+	UnknownHostRoute      = "route"
+	UnknownHostDrop       = "drop"
+	UnknownHostStatusOnly = "status_only"
+	UnknownHostDisconnect = "disconnect"
+
+	defaultUnknownHostMessage = "Unknown server address."
+
+	defaultLegacyPingMOTD       = "A Minecraft Server"
+	defaultLegacyPingVersion    = "1.6.4"
+	defaultLegacyPingProtocol   = 78
+	defaultLegacyPingMaxPlayers = 20
+
+	// UnixAddressPrefix marks backend addresses that are Unix domain socket paths
+	UnixAddressPrefix = "unix://"
+	// SRVAddressPrefix marks backend addresses resolved through _minecraft._tcp SRV records
+	SRVAddressPrefix = "srv://"
+
+	AddressMarkerPreserve = "preserve"
+	AddressMarkerStrip    = "strip"
+
+	ForwardingNone       = "none"
+	ForwardingBungeeCord = "bungeecord"
+
+	ForwardingUUIDOffline = "offline"
+	ForwardingUUIDOnline  = "online"
+
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
 
 type ProxyProtocolConfig struct {
 	SendToUpstream        bool `yaml:"send_to_upstream"`
 	ReceiveFromDownstream bool `yaml:"receive_from_downstream"`
 }
 
+// RotationConfig controls rotation of file log outputs.
+type RotationConfig struct {
+	MaxSize    int           `yaml:"max_size"`
+	Interval   time.Duration `yaml:"interval"`
+	MaxBackups int           `yaml:"max_backups"`
+	MaxAge     time.Duration `yaml:"max_age"`
+}
+
+func (r RotationConfig) valid() bool {
+	return r.MaxSize >= 0 && r.MaxBackups >= 0 && r.Interval >= 0 && r.MaxAge >= 0
+}
+
+// AccessLogConfig gives the access log its own format and destination.
+type AccessLogConfig struct {
+	Format   string         `yaml:"format"`
+	Output   string         `yaml:"output"`
+	Rotation RotationConfig `yaml:"rotation"`
+}
+
+// SamplingConfig limits how many rejection and parse error events are logged per interval.
+type SamplingConfig struct {
+	Limit    int           `yaml:"limit"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// LoggingConfig controls the log format and destination.
+type LoggingConfig struct {
+	Format      string          `yaml:"format"`
+	Output      string          `yaml:"output"`
+	AccessLevel string          `yaml:"access_level"`
+	Rotation    RotationConfig  `yaml:"rotation"`
+	AccessLog   AccessLogConfig `yaml:"access_log"`
+	Sampling    SamplingConfig  `yaml:"sampling"`
+}
+
+// TracingConfig controls export of connection lifecycle traces.
+type TracingConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Exporter string `yaml:"exporter"`
+	Endpoint string `yaml:"endpoint"`
+	Insecure bool   `yaml:"insecure"`
+	// SampleRatio is a pointer so an explicit 0, tracing no sessions, differs from leaving it out
+	SampleRatio *float64 `yaml:"sample_ratio"`
+	ServiceName string   `yaml:"service_name"`
+}
+
+// KeepAliveConfig sets the TCP keepalive period of client and backend sockets. Zero keeps the
+// Go default the listener and dialer apply, keepalives every 15 seconds, and a negative value
+// disables keepalives.
+type KeepAliveConfig struct {
+	Client  time.Duration `yaml:"client"`
+	Backend time.Duration `yaml:"backend"`
+}
+
+// SessionTimeouts limits how long a proxied session may stay idle and open in total,
+// zero means no limit.
+type SessionTimeouts struct {
+	Idle        time.Duration
+	MaxDuration time.Duration
+}
+
+// DialRetryConfig retries failed backend dials, all attempts share the dial timeout.
+type DialRetryConfig struct {
+	Attempts int           `yaml:"attempts"`
+	Backoff  time.Duration `yaml:"backoff"`
+}
+
+// CircuitBreakerConfig stops dialing a backend after consecutive failures until the cooldown has
+// passed and a single probe succeeds. Fallback and Message apply whenever a backend is unavailable.
+type CircuitBreakerConfig struct {
+	Failures int           `yaml:"failures"`
+	Cooldown time.Duration `yaml:"cooldown"`
+	Fallback string        `yaml:"fallback"`
+	Message  string        `yaml:"message"`
+}
+
+// StatusCacheConfig answers status pings from a cached response of each backend instead of
+// relaying every ping. The cache is refreshed when a ping finds it older than TTL, or every TTL in
+// the background while pings keep coming.
+type StatusCacheConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	TTL             time.Duration `yaml:"ttl"`
+	Background      bool          `yaml:"background"`
+	RewriteProtocol bool          `yaml:"rewrite_protocol"`
+}
+
+// LegacyPingConfig controls how pre-1.7 server list pings are answered.
+type LegacyPingConfig struct {
+	Action          string `yaml:"action"`
+	MOTD            string `yaml:"motd"`
+	VersionName     string `yaml:"version_name"`
+	ProtocolVersion int32  `yaml:"protocol_version"`
+	// MaxPlayers is a pointer so an explicit 0, advertising no slots, differs from leaving it out
+	MaxPlayers *int `yaml:"max_players"`
+}
+
 type Server struct {
-	Name          string               `yaml:"name"`
-	Address       string               `yaml:"address"`
-	Whitelist     []string             `yaml:"whitelist,omitempty"`
-	ProxyProtocol *ProxyProtocolConfig `yaml:"proxy_protocol,omitempty"`
+	Name               string  `yaml:"name"`
+	Address            string  `yaml:"address"`
+	Routes             []Route `yaml:"routes,omitempty"`
+	UnsupportedMessage string  `yaml:"unsupported_message,omitempty"`
+	AddressMarker      string  `yaml:"address_marker,omitempty"`
+	RewriteHost        string  `yaml:"rewrite_host,omitempty"`
+	RewritePort        uint16  `yaml:"rewrite_port,omitempty"`
+	Forwarding         string  `yaml:"forwarding,omitempty"`
+	ForwardingUUID     string  `yaml:"forwarding_uuid,omitempty"`
+	// TrustClientUUID acknowledges that forwarding_uuid online forwards a UUID nobody verified
+	TrustClientUUID    bool                 `yaml:"trust_client_uuid,omitempty"`
+	IdleTimeout        time.Duration        `yaml:"idle_timeout,omitempty"`
+	MaxSessionDuration time.Duration        `yaml:"max_session_duration,omitempty"`
+	Whitelist          []string             `yaml:"whitelist,omitempty"`
+	ProxyProtocol      *ProxyProtocolConfig `yaml:"proxy_protocol,omitempty"`
+	// Fallback names other servers whose backends are tried in order when this one is unavailable
+	Fallback            []string          `yaml:"fallback,omitempty"`
+	FallbackRewriteHost bool              `yaml:"fallback_rewrite_host,omitempty"`
+	Maintenance         MaintenanceConfig `yaml:"maintenance,omitempty"`
+	// StatusAggregate answers status pings with the players of several backends added up
+	StatusAggregate *StatusAggregateConfig `yaml:"status_aggregate,omitempty"`
 }
 
 type Config struct {
-	Timeout       time.Duration       `yaml:"timeout"`
-	ListenAddr    string              `yaml:"listen_addr"`
-	Default       string              `yaml:"default"`
-	LogLevel      string              `yaml:"log_level"`
-	Whitelist     []string            `yaml:"whitelist"`
-	ProxyProtocol ProxyProtocolConfig `yaml:"proxy_protocol"`
-	Servers       []Server            `yaml:"servers"`
+	Timeout            time.Duration        `yaml:"timeout"`
+	HandshakeTimeout   time.Duration        `yaml:"handshake_timeout"`
+	MaxHandshakes      int                  `yaml:"max_handshakes"`
+	IdleTimeout        time.Duration        `yaml:"idle_timeout"`
+	MaxSessionDuration time.Duration        `yaml:"max_session_duration"`
+	TCPKeepAlive       KeepAliveConfig      `yaml:"tcp_keepalive"`
+	DialRetry          DialRetryConfig      `yaml:"dial_retry"`
+	CircuitBreaker     CircuitBreakerConfig `yaml:"circuit_breaker"`
+	StatusCache        StatusCacheConfig    `yaml:"status_cache"`
+	ListenAddr         string               `yaml:"listen_addr"`
+	Default            string               `yaml:"default"`
+	UnknownHostAction  string               `yaml:"unknown_host_action"`
+	UnknownHostMessage string               `yaml:"unknown_host_message"`
+	LogLevel           string               `yaml:"log_level"`
+	Logging            LoggingConfig        `yaml:"logging"`
+	Tracing            TracingConfig        `yaml:"tracing"`
+	Whitelist          []string             `yaml:"whitelist"`
+	ProxyProtocol      ProxyProtocolConfig  `yaml:"proxy_protocol"`
+	LegacyPing         LegacyPingConfig     `yaml:"legacy_ping"`
+	Servers            []Server             `yaml:"servers"`
 
 	// Parsed whitelist networks (populated after loading)
-	globalWhitelist  []*net.IPNet
-	serverWhitelists map[string][]*net.IPNet
+	globalWhitelist   []*net.IPNet
+	serverWhitelists  map[string][]*net.IPNet
+	serverRoutes      map[string][]parsedRoute
+	maintenanceBypass map[string]maintenanceBypass
 }
 
 func parseWhitelist(entries []string) []*net.IPNet {
@@ -79,14 +254,88 @@ func (c *Config) parseWhitelists() {
 }
 
 func applyDefaults(config *Config) {
+	if config.HandshakeTimeout == 0 {
+		config.HandshakeTimeout = defaultHandshakeTimeout
+	}
+	if config.MaxHandshakes == 0 {
+		config.MaxHandshakes = defaultMaxHandshakes
+	}
+	if config.DialRetry.Attempts == 0 {
+		config.DialRetry.Attempts = defaultDialAttempts
+	}
+	if config.DialRetry.Backoff == 0 {
+		config.DialRetry.Backoff = defaultDialBackoff
+	}
+	if config.CircuitBreaker.Cooldown == 0 {
+		config.CircuitBreaker.Cooldown = defaultBreakerCooldown
+	}
+	if config.CircuitBreaker.Message == "" {
+		config.CircuitBreaker.Message = defaultUnavailableMessage
+	}
+	if config.StatusCache.TTL == 0 {
+		config.StatusCache.TTL = defaultStatusCacheTTL
+	}
+
 	config.LogLevel = strings.TrimSpace(strings.ToLower(config.LogLevel))
 	if config.LogLevel == "warning" {
 		config.LogLevel = "warn"
 	}
-	if config.LogLevel != "" {
-		return
+	if config.LogLevel == "" {
+		config.LogLevel = defaultLogLevel
+	}
+
+	config.Logging.Format = strings.TrimSpace(strings.ToLower(config.Logging.Format))
+	if config.Logging.Format == "" {
+		config.Logging.Format = defaultLogFormat
+	}
+	config.Logging.Output = strings.TrimSpace(config.Logging.Output)
+	if config.Logging.Output == "" {
+		config.Logging.Output = defaultLogOutput
+	}
+	config.Logging.AccessLevel = strings.TrimSpace(strings.ToLower(config.Logging.AccessLevel))
+	if config.Logging.AccessLevel == "warning" {
+		config.Logging.AccessLevel = "warn"
+	}
+	if config.Logging.AccessLevel == "" {
+		config.Logging.AccessLevel = defaultLogLevel
+	}
+	config.Logging.AccessLog.Format = strings.TrimSpace(strings.ToLower(config.Logging.AccessLog.Format))
+	config.Logging.AccessLog.Output = strings.TrimSpace(config.Logging.AccessLog.Output)
+
+	config.Tracing.Exporter = strings.TrimSpace(strings.ToLower(config.Tracing.Exporter))
+	if config.Tracing.Exporter == "" {
+		config.Tracing.Exporter = TracingExporterOTLP
+	}
+	if config.Tracing.SampleRatio == nil {
+		ratio := 1.0
+		config.Tracing.SampleRatio = &ratio
+	}
+
+	config.UnknownHostAction = strings.TrimSpace(strings.ToLower(config.UnknownHostAction))
+	if config.UnknownHostAction == "" {
+		config.UnknownHostAction = UnknownHostRoute
+	}
+	if config.UnknownHostMessage == "" {
+		config.UnknownHostMessage = defaultUnknownHostMessage
+	}
+
+	config.LegacyPing.Action = strings.TrimSpace(strings.ToLower(config.LegacyPing.Action))
+	if config.LegacyPing.Action == "" {
+		config.LegacyPing.Action = LegacyPingRespond
+	}
+	if config.LegacyPing.MOTD == "" {
+		config.LegacyPing.MOTD = defaultLegacyPingMOTD
+	}
+	if config.LegacyPing.VersionName == "" {
+		config.LegacyPing.VersionName = defaultLegacyPingVersion
+	}
+	if config.LegacyPing.ProtocolVersion == 0 {
+		config.LegacyPing.ProtocolVersion = defaultLegacyPingProtocol
+	}
+	if config.LegacyPing.MaxPlayers == nil {
+		maxPlayers := defaultLegacyPingMaxPlayers
+		config.LegacyPing.MaxPlayers = &maxPlayers
 	}
-	config.LogLevel = defaultLogLevel
 }
 
 // GetWhitelist returns the whitelist for the given server name, or global whitelist if not specified.
@@ -107,16 +356,99 @@ func (c *Config) GetProxyProtocol(serverName string) ProxyProtocolConfig {
 	return c.ProxyProtocol
 }
 
-// GetServerAddress returns the backend address for the given server name.
-func (c *Config) GetServerAddress(serverName string) string {
+// GetSessionTimeouts returns the idle timeout and maximum duration of sessions to the given server,
+// each falling back to the global value when the server does not set it.
+func (c *Config) GetSessionTimeouts(serverName string) SessionTimeouts {
+	timeouts := SessionTimeouts{Idle: c.IdleTimeout, MaxDuration: c.MaxSessionDuration}
 	for _, server := range c.Servers {
-		if server.Name == serverName {
-			return server.Address
+		if server.Name != serverName {
+			continue
+		}
+		if server.IdleTimeout != 0 {
+			timeouts.Idle = server.IdleTimeout
+		}
+		if server.MaxSessionDuration != 0 {
+			timeouts.MaxDuration = server.MaxSessionDuration
 		}
+		break
+	}
+	return timeouts
+}
+
+// GetServerAddress returns the backend address for the given server name, protocol version and client type.
+// Routes are checked in order and the server address is used when none match. An empty string
+// means the server is known but has no backend for this client.
+func (c *Config) GetServerAddress(serverName string, protocolVersion int32, modded bool) string {
+	for _, server := range c.Servers {
+		if server.Name != serverName {
+			continue
+		}
+		for _, route := range c.serverRoutes[serverName] {
+			if route.matches(protocolVersion, modded) {
+				return route.address
+			}
+		}
+		return server.Address
 	}
 	return c.Default
 }
 
+// HasServer reports whether a server with the given name is configured.
+func (c *Config) HasServer(serverName string) bool {
+	return slices.ContainsFunc(c.Servers, func(s Server) bool { return s.Name == serverName })
+}
+
+// GetHandshakeRewrite returns the host and port the forwarded handshake should carry for the given server.
+// Empty values mean the client's host or port is kept.
+func (c *Config) GetHandshakeRewrite(serverName string) (string, uint16) {
+	for _, server := range c.Servers {
+		if server.Name == serverName {
+			return server.RewriteHost, server.RewritePort
+		}
+	}
+	return "", 0
+}
+
+// GetForwarding returns the player info forwarding mode and UUID source for the given server.
+func (c *Config) GetForwarding(serverName string) (string, string) {
+	for _, server := range c.Servers {
+		if server.Name != serverName {
+			continue
+		}
+		mode, uuid := server.Forwarding, server.ForwardingUUID
+		if mode == "" {
+			mode = ForwardingNone
+		}
+		if uuid == "" {
+			uuid = ForwardingUUIDOffline
+		}
+		return mode, uuid
+	}
+	return ForwardingNone, ForwardingUUIDOffline
+}
+
+// GetFallback returns the fallback servers of the given server and whether the forwarded
+// handshake is addressed to the fallback server instead of the one the client asked for.
+func (c *Config) GetFallback(serverName string) ([]string, bool) {
+	for _, server := range c.Servers {
+		if server.Name == serverName {
+			return server.Fallback, server.FallbackRewriteHost
+		}
+	}
+	return nil, false
+}
+
+// StripAddressMarker reports whether data appended to the handshake server address, such as
+// a Forge marker, should be removed before the handshake is forwarded to the given server.
+func (c *Config) StripAddressMarker(serverName string) bool {
+	for _, server := range c.Servers {
+		if server.Name == serverName {
+			return server.AddressMarker == AddressMarkerStrip
+		}
+	}
+	return false
+}
+
 // IsAllowed checks if the IP is allowed by the whitelist for the given server.
 func (c *Config) IsAllowed(serverName string, ip net.IP) bool {
 	if ip == nil {
@@ -148,26 +480,141 @@ func validateConfig(config *Config) error {
 	if config.ListenAddr == "" {
 		return fmt.Errorf("listen address cannot be empty")
 	}
-	if len(config.Servers) == 0 {
-		return fmt.Errorf("at least one server must be defined")
+	if config.HandshakeTimeout < 0 || config.IdleTimeout < 0 || config.MaxSessionDuration < 0 {
+		return fmt.Errorf("handshake_timeout, idle_timeout and max_session_duration cannot be negative")
+	}
+	if config.MaxHandshakes < 0 {
+		return fmt.Errorf("max_handshakes cannot be negative")
+	}
+	if config.DialRetry.Attempts < 0 || config.DialRetry.Backoff < 0 {
+		return fmt.Errorf("dial_retry.attempts and dial_retry.backoff cannot be negative")
+	}
+	if config.CircuitBreaker.Failures < 0 || config.CircuitBreaker.Cooldown < 0 {
+		return fmt.Errorf("circuit_breaker.failures and circuit_breaker.cooldown cannot be negative")
+	}
+	if config.StatusCache.TTL < 0 {
+		return fmt.Errorf("status_cache.ttl cannot be negative")
+	}
+	if err := validateBackendAddress(config.CircuitBreaker.Fallback); err != nil {
+		return fmt.Errorf("%w for circuit_breaker.fallback", err)
 	}
 	for _, server := range config.Servers {
 		if server.Name == "" {
 			return fmt.Errorf("server name cannot be empty")
 		}
-		if server.Address == "" {
+		if server.Address == "" && len(server.Routes) == 0 {
 			return fmt.Errorf("server address cannot be empty for server: %s", server.Name)
 		}
+		if err := validateBackendAddress(server.Address); err != nil {
+			return fmt.Errorf("%w for server: %s", err, server.Name)
+		}
+		for _, route := range server.Routes {
+			if route.Address == "" {
+				return fmt.Errorf("route address cannot be empty for server: %s", server.Name)
+			}
+			if err := validateBackendAddress(route.Address); err != nil {
+				return fmt.Errorf("%w in routes of server: %s", err, server.Name)
+			}
+		}
+		switch server.AddressMarker {
+		case "", AddressMarkerPreserve, AddressMarkerStrip:
+		default:
+			return fmt.Errorf("address_marker must be preserve or strip for server: %s", server.Name)
+		}
+		switch server.Forwarding {
+		case "", ForwardingNone, ForwardingBungeeCord:
+		default:
+			return fmt.Errorf("forwarding must be none or bungeecord for server: %s", server.Name)
+		}
+		if server.IdleTimeout < 0 || server.MaxSessionDuration < 0 {
+			return fmt.Errorf("idle_timeout and max_session_duration cannot be negative for server: %s", server.Name)
+		}
+		switch server.ForwardingUUID {
+		case "", ForwardingUUIDOffline, ForwardingUUIDOnline:
+		default:
+			return fmt.Errorf("forwarding_uuid must be offline or online for server: %s", server.Name)
+		}
+		// The gateway does not authenticate players, any client can claim any UUID in its login start
+		if server.ForwardingUUID == ForwardingUUIDOnline && !server.TrustClientUUID {
+			return fmt.Errorf("forwarding_uuid online forwards unverified client UUIDs and needs trust_client_uuid: true for server: %s", server.Name)
+		}
+		for _, fallback := range server.Fallback {
+			if fallback == server.Name || !config.HasServer(fallback) {
+				return fmt.Errorf("fallback %s must be another configured server for server: %s", fallback, server.Name)
+			}
+		}
+		if server.StatusAggregate != nil {
+			if err := validateStatusAggregate(&server); err != nil {
+				return err
+			}
+		}
+	}
+	switch config.UnknownHostAction {
+	case UnknownHostRoute, UnknownHostDrop, UnknownHostStatusOnly, UnknownHostDisconnect:
+	default:
+		return fmt.Errorf("unknown_host_action must be one of route, drop, status_only or disconnect")
 	}
-	if config.Default == "" {
-		return fmt.Errorf("default backend address cannot be empty")
+	if err := validateBackendAddress(config.Default); err != nil {
+		return fmt.Errorf("%w for default", err)
 	}
 	switch config.LogLevel {
 	case "debug", "info", "warn", "error":
-		return nil
 	default:
 		return fmt.Errorf("log_level must be one of debug, info, warn or error")
 	}
+	switch config.Logging.AccessLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("logging.access_level must be one of debug, info, warn or error")
+	}
+	switch config.Logging.Format {
+	case "console", "json":
+	default:
+		return fmt.Errorf("logging.format must be console or json")
+	}
+	switch config.Logging.AccessLog.Format {
+	case "", "console", "json":
+	default:
+		return fmt.Errorf("logging.access_log.format must be console or json")
+	}
+	if !config.Logging.Rotation.valid() || !config.Logging.AccessLog.Rotation.valid() {
+		return fmt.Errorf("logging rotation values cannot be negative")
+	}
+	if config.Logging.Sampling.Interval < 0 {
+		return fmt.Errorf("logging.sampling.interval cannot be negative")
+	}
+	switch config.Tracing.Exporter {
+	case TracingExporterOTLP, TracingExporterStdout:
+	default:
+		return fmt.Errorf("tracing.exporter must be otlp or stdout")
+	}
+	if ratio := *config.Tracing.SampleRatio; ratio < 0 || ratio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+	switch config.LegacyPing.Action {
+	case LegacyPingRespond, LegacyPingForward, LegacyPingDrop:
+	default:
+		return fmt.Errorf("legacy_ping.action must be one of respond, forward or drop")
+	}
+	if *config.LegacyPing.MaxPlayers < 0 {
+		return fmt.Errorf("legacy_ping.max_players cannot be negative")
+	}
+	if config.Default == "" && config.LegacyPing.Action == LegacyPingForward {
+		return fmt.Errorf("default backend address cannot be empty when legacy_ping.action is forward")
+	}
+	return nil
+}
+
+// validateRouting checks that the servers and default of a config file can route connections.
+// Configs built in code may leave them out when a custom Router picks the backends.
+func validateRouting(config *Config) error {
+	if len(config.Servers) == 0 {
+		return fmt.Errorf("at least one server must be defined")
+	}
+	if config.Default == "" && config.UnknownHostAction == UnknownHostRoute {
+		return fmt.Errorf("default backend address cannot be empty when unknown_host_action is route")
+	}
+	return nil
 }
 
 func LoadConfig(filename string) (*Config, error) {
@@ -180,14 +627,40 @@ func LoadConfig(filename string) (*Config, error) {
 	if err := yaml.Unmarshal(data, config); err != nil {
 		return nil, fmt.Errorf("error decoding config from YAML: %v", err)
 	}
+	if err := config.Prepare(); err != nil {
+		return nil, err
+	}
+	if err := validateRouting(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	return config, nil
+}
 
-	applyDefaults(config)
+// Prepare fills in defaults, validates the config and parses its whitelists and routes.
+// LoadConfig calls it, configs built in code must be prepared before they are used. Unlike
+// config files they may have no servers and no default when a custom Router is set.
+func (c *Config) Prepare() error {
+	applyDefaults(c)
 
-	if err := validateConfig(config); err != nil {
-		return nil, fmt.Errorf("invalid config: %v", err)
+	if err := validateConfig(c); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
 	}
 
-	config.parseWhitelists()
+	c.parseWhitelists()
+	c.parseMaintenance()
+	if err := c.parseRoutes(); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	return nil
+}
 
-	return config, nil
+// validateBackendAddress rejects Unix socket addresses without a path and SRV addresses without a name.
+func validateBackendAddress(address string) error {
+	switch address {
+	case UnixAddressPrefix:
+		return fmt.Errorf("unix socket address needs a path")
+	case SRVAddressPrefix:
+		return fmt.Errorf("srv address needs a name")
+	}
+	return nil
 }
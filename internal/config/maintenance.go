@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+const (
+	defaultMaintenanceMOTD    = "Server is under maintenance"
+	defaultMaintenanceVersion = "Maintenance"
+	defaultMaintenanceMessage = "The server is under maintenance, please come back later."
+)
+
+// MaintenanceConfig takes a server offline for players. Status pings show the MOTD and version
+// text, logins are disconnected with the message unless the client is on the bypass list of
+// IP addresses, CIDR ranges and usernames.
+type MaintenanceConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	MOTD        string   `yaml:"motd,omitempty"`
+	VersionName string   `yaml:"version_name,omitempty"`
+	Message     string   `yaml:"message,omitempty"`
+	Bypass      []string `yaml:"bypass,omitempty"`
+}
+
+// maintenanceBypass is the parsed bypass list of a server.
+type maintenanceBypass struct {
+	networks  []*net.IPNet
+	usernames map[string]bool
+}
+
+func parseMaintenanceBypass(entries []string) maintenanceBypass {
+	bypass := maintenanceBypass{networks: parseWhitelist(entries), usernames: make(map[string]bool)}
+	for _, entry := range entries {
+		if _, _, err := net.ParseCIDR(entry); err == nil || net.ParseIP(entry) != nil || entry == "" {
+			continue
+		}
+		bypass.usernames[strings.ToLower(entry)] = true
+	}
+	return bypass
+}
+
+func (c *Config) parseMaintenance() {
+	c.maintenanceBypass = make(map[string]maintenanceBypass)
+	for _, server := range c.Servers {
+		if len(server.Maintenance.Bypass) > 0 {
+			c.maintenanceBypass[server.Name] = parseMaintenanceBypass(server.Maintenance.Bypass)
+		}
+	}
+}
+
+// GetMaintenance returns the maintenance settings of the given server with defaults filled in.
+func (c *Config) GetMaintenance(serverName string) MaintenanceConfig {
+	var maintenance MaintenanceConfig
+	for _, server := range c.Servers {
+		if server.Name == serverName {
+			maintenance = server.Maintenance
+			break
+		}
+	}
+	if maintenance.MOTD == "" {
+		maintenance.MOTD = defaultMaintenanceMOTD
+	}
+	if maintenance.VersionName == "" {
+		maintenance.VersionName = defaultMaintenanceVersion
+	}
+	if maintenance.Message == "" {
+		maintenance.Message = defaultMaintenanceMessage
+	}
+	return maintenance
+}
+
+// BypassesMaintenance reports whether a client may join the given server during maintenance,
+// by its IP address or, once the login start has been read, its username.
+func (c *Config) BypassesMaintenance(serverName string, ip net.IP, username string) bool {
+	bypass, ok := c.maintenanceBypass[serverName]
+	if !ok {
+		return false
+	}
+	if username != "" && bypass.usernames[strings.ToLower(username)] {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range bypass.networks {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadMaintenanceState reads the maintenance flags set at runtime by server name,
+// a missing file means none are set.
+func LoadMaintenanceState(filename string) (map[string]bool, error) {
+	state := make(map[string]bool)
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read maintenance state: %v", err)
+	}
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse maintenance state: %v", err)
+	}
+	return state, nil
+}
+
+// SaveMaintenanceState writes the maintenance flags set at runtime.
+func SaveMaintenanceState(filename string, state map[string]bool) error {
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
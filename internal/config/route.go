@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const defaultUnsupportedMessage = "Your Minecraft version is not supported by this server."
+
+// Route selects a backend for clients matching all of its conditions.
+// An empty protocol expression matches every version, an unset modded flag matches every client.
+type Route struct {
+	Protocol string `yaml:"protocol,omitempty"`
+	Modded   *bool  `yaml:"modded,omitempty"`
+	Address  string `yaml:"address"`
+}
+
+type versionCondition struct {
+	op      string
+	version int32
+}
+
+type versionMatcher []versionCondition
+
+type parsedRoute struct {
+	matcher versionMatcher
+	modded  *bool
+	address string
+}
+
+func (r parsedRoute) matches(protocolVersion int32, modded bool) bool {
+	if r.modded != nil && *r.modded != modded {
+		return false
+	}
+	return r.matcher.matches(protocolVersion)
+}
+
+// parseVersionMatcher parses expressions like "<= 47", ">= 763", "340" or ">= 107, <= 340".
+func parseVersionMatcher(expr string) (versionMatcher, error) {
+	var matcher versionMatcher
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		op := "=="
+		for _, candidate := range []string{"<=", ">=", "==", "!=", "<", ">", "="} {
+			if strings.HasPrefix(part, candidate) {
+				op = candidate
+				part = strings.TrimSpace(part[len(candidate):])
+				break
+			}
+		}
+		if op == "=" {
+			op = "=="
+		}
+		version, err := strconv.ParseInt(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid protocol version %q", part)
+		}
+		matcher = append(matcher, versionCondition{op: op, version: int32(version)})
+	}
+	if len(matcher) == 0 {
+		return nil, fmt.Errorf("empty protocol version expression")
+	}
+	return matcher, nil
+}
+
+func (m versionMatcher) matches(version int32) bool {
+	for _, cond := range m {
+		var ok bool
+		switch cond.op {
+		case "<=":
+			ok = version <= cond.version
+		case ">=":
+			ok = version >= cond.version
+		case "<":
+			ok = version < cond.version
+		case ">":
+			ok = version > cond.version
+		case "!=":
+			ok = version != cond.version
+		default:
+			ok = version == cond.version
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Config) parseRoutes() error {
+	c.serverRoutes = make(map[string][]parsedRoute)
+	for _, server := range c.Servers {
+		for _, route := range server.Routes {
+			var matcher versionMatcher
+			if route.Protocol != "" {
+				var err error
+				matcher, err = parseVersionMatcher(route.Protocol)
+				if err != nil {
+					return fmt.Errorf("invalid route for server %s: %v", server.Name, err)
+				}
+			}
+			c.serverRoutes[server.Name] = append(c.serverRoutes[server.Name], parsedRoute{
+				matcher: matcher,
+				modded:  route.Modded,
+				address: route.Address,
+			})
+		}
+	}
+	return nil
+}
+
+// GetUnsupportedMessage returns the message shown to clients whose protocol version has no matching route.
+func (c *Config) GetUnsupportedMessage(serverName string) string {
+	for _, server := range c.Servers {
+		if server.Name == serverName && server.UnsupportedMessage != "" {
+			return server.UnsupportedMessage
+		}
+	}
+	return defaultUnsupportedMessage
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+)
+
+// StatusAggregateConfig answers status pings of a server spread over several backends with a
+// single response counting the players of all backends that answer. Backends default to the
+// address of the server, srv:// addresses stand for every target of their records. The MOTD and
+// favicon, a path to a 64x64 PNG, replace those of the backends when set.
+type StatusAggregateConfig struct {
+	Backends []string `yaml:"backends,omitempty"`
+	MOTD     string   `yaml:"motd,omitempty"`
+	Favicon  string   `yaml:"favicon,omitempty"`
+
+	// Favicon file as a data URI (populated after loading)
+	faviconURI string
+}
+
+// FaviconURI returns the configured favicon as sent in status responses, or an empty string.
+func (a *StatusAggregateConfig) FaviconURI() string {
+	return a.faviconURI
+}
+
+// validateStatusAggregate checks the backends of an aggregated status and reads its favicon.
+func validateStatusAggregate(server *Server) error {
+	aggregate := server.StatusAggregate
+	if len(aggregate.Backends) == 0 && server.Address == "" {
+		return fmt.Errorf("status_aggregate needs backends or a server address for server: %s", server.Name)
+	}
+	for _, backend := range aggregate.Backends {
+		if backend == "" {
+			return fmt.Errorf("status_aggregate backend cannot be empty for server: %s", server.Name)
+		}
+		if err := validateBackendAddress(backend); err != nil {
+			return fmt.Errorf("%w in status_aggregate of server: %s", err, server.Name)
+		}
+	}
+	if aggregate.Favicon != "" {
+		data, err := os.ReadFile(aggregate.Favicon)
+		if err != nil {
+			return fmt.Errorf("failed to read status_aggregate favicon of server %s: %v", server.Name, err)
+		}
+		aggregate.faviconURI = "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+	}
+	return nil
+}
+
+// GetStatusAggregate returns the aggregated status settings of the given server and its backends,
+// or nil when its status pings are not aggregated.
+func (c *Config) GetStatusAggregate(serverName string) (*StatusAggregateConfig, []string) {
+	for _, server := range c.Servers {
+		if server.Name != serverName || server.StatusAggregate == nil {
+			continue
+		}
+		backends := server.StatusAggregate.Backends
+		if len(backends) == 0 {
+			backends = []string{server.Address}
+		}
+		return server.StatusAggregate, backends
+	}
+	return nil, nil
+}
@@ -0,0 +1,37 @@
+package gateway
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+// blackholeAddr returns a loopback address whose connection attempts hang: its listener has
+// a backlog of zero that is already filled, so further SYNs are dropped.
+func blackholeAddr(t *testing.T) string {
+	t.Helper()
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("socket: %v", err)
+	}
+	t.Cleanup(func() { _ = syscall.Close(fd) })
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatalf("getsockname: %v", err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(sa.(*syscall.SockaddrInet4).Port))
+
+	filler, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("fill backlog: %v", err)
+	}
+	t.Cleanup(func() { _ = filler.Close() })
+	return addr
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package gateway
+
+import "testing"
+
+// blackholeAddr relies on how Linux drops SYNs beyond the listen backlog.
+func blackholeAddr(t *testing.T) string {
+	t.Skip("blackhole listener needs Linux")
+	return ""
+}
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errBreakerOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker tracks consecutive dial failures of a backend. Once open it rejects dials until the
+// cooldown has passed, then lets a single probe through whose outcome closes or reopens it.
+type breaker struct {
+	addr string
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// allow reports whether a dial may be attempted now.
+func (b *breaker) allow(cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		logger.Infof("Probing backend %s after circuit breaker cooldown", b.addr)
+		return true
+	case breakerHalfOpen:
+		// A probe is already running
+		return false
+	}
+	return true
+}
+
+// done records the outcome of a dial allowed by allow.
+func (b *breaker) done(ok bool, threshold int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ok {
+		if b.state != breakerClosed {
+			logger.Infof("Backend %s is reachable again, closing circuit breaker", b.addr)
+		}
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= threshold) {
+		if b.state == breakerClosed {
+			logger.Warnf("Backend %s failed %d times in a row, opening circuit breaker", b.addr, b.failures)
+		}
+		b.state, b.openedAt = breakerOpen, time.Now()
+	}
+}
+
+// abandon records a dial allowed by allow that was cancelled before it had an outcome. A
+// cancelled probe leaves the breaker open with its cooldown passed, so the next dial probes again.
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+// breakers holds one breaker per backend address.
+type breakers struct {
+	mu sync.Mutex
+	m  map[string]*breaker
+}
+
+func (bs *breakers) get(addr string) *breaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, ok := bs.m[addr]
+	if !ok {
+		if bs.m == nil {
+			bs.m = make(map[string]*breaker)
+		}
+		b = &breaker{addr: addr}
+		bs.m[addr] = b
+	}
+	return b
+}
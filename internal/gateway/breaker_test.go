@@ -0,0 +1,39 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBreakerIgnoresCancelledProbe(t *testing.T) {
+	l := listen(t)
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	conf := newTestConfig(t, addr)
+	conf.CircuitBreaker.Failures = 1
+	conf.CircuitBreaker.Cooldown = 100 * time.Millisecond
+	g := NewGateway(conf)
+
+	if _, err := g.dialWithRetry(context.Background(), conf, addr); err == nil {
+		t.Fatal("dial to a closed port succeeded")
+	}
+	if _, err := g.dialWithRetry(context.Background(), conf, addr); err != errBreakerOpen {
+		t.Fatalf("dial after a failure = %v, want errBreakerOpen", err)
+	}
+
+	// The probe after the cooldown is cancelled by its caller, as Shutdown does
+	time.Sleep(conf.CircuitBreaker.Cooldown)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.dialWithRetry(ctx, conf, addr); err == nil || err == errBreakerOpen {
+		t.Fatalf("cancelled probe = %v, want a dial error", err)
+	}
+
+	// The next dial probes again right away instead of waiting out another cooldown
+	b := g.breakers.get(addr)
+	if !b.allow(conf.CircuitBreaker.Cooldown) {
+		t.Fatal("breaker reopened by a cancelled probe")
+	}
+}
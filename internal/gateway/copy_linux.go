@@ -0,0 +1,12 @@
+package gateway
+
+import (
+	"io"
+	"net"
+)
+
+// copyConn copies src to dst. Between TCP connections the kernel splices the data, so no
+// buffer is needed.
+func copyConn(dst, src net.Conn) (int64, error) {
+	return io.Copy(dst, src)
+}
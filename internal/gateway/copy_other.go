@@ -0,0 +1,16 @@
+//go:build !linux
+
+package gateway
+
+import (
+	"io"
+	"net"
+)
+
+// copyConn copies src to dst through a pooled buffer. Without splice the standard library
+// would allocate a new buffer for every copy, so ReadFrom and WriteTo are hidden from it.
+func copyConn(dst, src net.Conn) (int64, error) {
+	buf := copyBuffers.get()
+	defer copyBuffers.put(buf)
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, (*buf)[:cap(*buf)])
+}
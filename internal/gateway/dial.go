@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+// backendNetwork splits a backend address into the network and address to dial.
+// Addresses of the form unix:///path/to.sock are Unix domain sockets, anything else is TCP.
+func backendNetwork(backendAddr string) (network, address string) {
+	if path, ok := strings.CutPrefix(backendAddr, config.UnixAddressPrefix); ok {
+		return "unix", path
+	}
+	return "tcp", backendAddr
+}
+
+// backendTarget is a backend address to connect to, server names the fallback server it belongs
+// to and is empty for the routed backend and the global fallback.
+type backendTarget struct {
+	server string
+	addr   string
+}
+
+// backendTargets lists the routed backend followed by the fallback servers of serverName and the
+// global fallback, skipping addresses already listed and fallback servers under maintenance.
+// Fallback servers are resolved for the client of the handshake, legacy pings without one only
+// get the global fallback.
+func (g *Gateway) backendTargets(conf *config.Config, serverName, backendAddr string, handshake *protocol.HandshakePacket) []backendTarget {
+	targets := []backendTarget{{addr: backendAddr}}
+	add := func(server, addr string) {
+		if addr != "" && !slices.ContainsFunc(targets, func(t backendTarget) bool { return t.addr == addr }) {
+			targets = append(targets, backendTarget{server: server, addr: addr})
+		}
+	}
+	if handshake != nil {
+		fallbacks, _ := conf.GetFallback(serverName)
+		for _, fallback := range fallbacks {
+			if g.inMaintenance(conf, fallback) {
+				continue
+			}
+			add(fallback, conf.GetServerAddress(fallback, int32(handshake.ProtocolVersion), handshake.IsModded()))
+		}
+	}
+	add("", conf.CircuitBreaker.Fallback)
+	return targets
+}
+
+// connectBackend connects to the first available of targets and returns the connection together
+// with the target it was made to, or the last target tried when none was available.
+func (g *Gateway) connectBackend(ctx context.Context, conf *config.Config, targets []backendTarget) (net.Conn, backendTarget, error) {
+	var err error
+	for i, target := range targets {
+		if i > 0 {
+			logger.Warnf("Backend %s is unavailable, trying fallback %s: %s", targets[i-1].addr, target.addr, err)
+		}
+		var conn net.Conn
+		conn, err = g.dialWithRetry(ctx, conf, target.addr)
+		if err == nil || ctx.Err() != nil {
+			return conn, target, err
+		}
+	}
+	return nil, targets[len(targets)-1], err
+}
+
+// dialWithRetry dials a backend until it accepts or the attempts or the dial timeout run out,
+// waiting a doubling backoff between attempts. Dials to backends with an open circuit breaker
+// fail right away.
+func (g *Gateway) dialWithRetry(ctx context.Context, conf *config.Config, backendAddr string) (net.Conn, error) {
+	var b *breaker
+	if conf.CircuitBreaker.Failures > 0 {
+		b = g.breakers.get(backendAddr)
+		if !b.allow(conf.CircuitBreaker.Cooldown) {
+			return nil, errBreakerOpen
+		}
+	}
+
+	// Running out of the dial timeout counts against the backend, a cancelled caller does not
+	caller := ctx
+	if conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.Timeout)
+		defer cancel()
+	}
+	dialer := net.Dialer{KeepAlive: conf.TCPKeepAlive.Backend}
+	backoff := conf.DialRetry.Backoff
+
+	var conn net.Conn
+	var err error
+	for attempt := 1; ; attempt++ {
+		conn, err = g.dialBackend(ctx, &dialer, backendAddr)
+		if err == nil || attempt >= conf.DialRetry.Attempts || ctx.Err() != nil {
+			break
+		}
+		logger.Debugf("Failed to connect to backend %s (attempt %d of %d), retrying in %s: %s", backendAddr, attempt, conf.DialRetry.Attempts, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		backoff *= 2
+	}
+	switch {
+	case b == nil:
+	case err != nil && caller.Err() != nil:
+		b.abandon()
+	default:
+		b.done(err == nil, conf.CircuitBreaker.Failures)
+	}
+	return conn, err
+}
+
+// dialBackend connects to a backend address, giving up when ctx is done. The targets of an
+// srv:// address are tried in order until one accepts, each getting an even share of the time
+// left until the deadline of ctx so a target that never answers leaves time for the next ones.
+func (g *Gateway) dialBackend(ctx context.Context, dialer *net.Dialer, backendAddr string) (net.Conn, error) {
+	name, ok := strings.CutPrefix(backendAddr, config.SRVAddressPrefix)
+	if !ok {
+		network, address := backendNetwork(backendAddr)
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	targets, err := g.srv.targets(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for i, target := range targets {
+		targetCtx, cancel := ctx, context.CancelFunc(func() {})
+		if deadline, ok := ctx.Deadline(); ok {
+			targetCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/time.Duration(len(targets)-i))
+		}
+		conn, err := dialer.DialContext(targetCtx, "tcp", target)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		logger.Debugf("Failed to connect to SRV target %s of %s: %s", target, name, err)
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if lastErr == nil {
+		return nil, fmt.Errorf("no usable SRV targets for %s", name)
+	}
+	return nil, fmt.Errorf("all SRV targets of %s failed, last error: %w", name, lastErr)
+}
@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+// errorClass is the category of an error seen on a client or backend connection. It drives
+// the log level, the sampling of rejection logs and the close reason of sessions.
+type errorClass string
+
+const (
+	errorClassNone        errorClass = ""
+	errorClassEOF         errorClass = "eof"
+	errorClassClosed      errorClass = "closed"
+	errorClassReset       errorClass = "reset"
+	errorClassTimeout     errorClass = "timeout"
+	errorClassRefused     errorClass = "refused"
+	errorClassUnreachable errorClass = "unreachable"
+	errorClassProtocol    errorClass = "protocol"
+	errorClassOther       errorClass = "other"
+)
+
+func classifyError(err error) errorClass {
+	switch {
+	case err == nil:
+		return errorClassNone
+	// Checked first, a truncated field inside a packet is bad data rather than a closed connection
+	case errors.Is(err, protocol.ErrMalformedPacket):
+		return errorClassProtocol
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errorClassEOF
+	case errors.Is(err, net.ErrClosed):
+		return errorClassClosed
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return errorClassTimeout
+	case isErrno(err, resetErrnos):
+		return errorClassReset
+	case isErrno(err, refusedErrnos):
+		return errorClassRefused
+	case isErrno(err, unreachableErrnos):
+		return errorClassUnreachable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errorClassTimeout
+	}
+	return errorClassOther
+}
+
+// expected reports whether the class is a normal way for a connection to end or fail,
+// as opposed to a bug or bad data worth a warning.
+func (c errorClass) expected() bool {
+	switch c {
+	case errorClassEOF, errorClassClosed, errorClassReset, errorClassTimeout, errorClassRefused, errorClassUnreachable:
+		return true
+	default:
+		return false
+	}
+}
+
+func isErrno(err error, errnos []syscall.Errno) bool {
+	for _, errno := range errnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExpectedNetworkError reports whether err is a normal way for a connection to end.
+func isExpectedNetworkError(err error) bool {
+	return classifyError(err).expected()
+}
+
+// closeReasonFor maps how one side of a proxied session ended to the session close reason.
+func closeReasonFor(clientSide bool, err error) closeReason {
+	switch classifyError(err) {
+	case errorClassNone, errorClassEOF, errorClassClosed:
+		if clientSide {
+			return closeClientEOF
+		}
+		return closeBackendEOF
+	case errorClassReset:
+		if clientSide {
+			return closeClientReset
+		}
+		return closeBackendReset
+	case errorClassTimeout:
+		return closeTimeout
+	case errorClassProtocol:
+		return closeProtocolError
+	case errorClassRefused, errorClassUnreachable:
+		return closeBackendUnavailable
+	default:
+		return closeError
+	}
+}
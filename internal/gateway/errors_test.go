@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	return l
+}
+
+// connPair returns both ends of a loopback TCP connection.
+func connPair(t *testing.T) (client, server *net.TCPConn) {
+	t.Helper()
+	l := listen(t)
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	peer := <-accepted
+	if peer == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = peer.Close()
+	})
+	return conn.(*net.TCPConn), peer.(*net.TCPConn)
+}
+
+func closedListenerError(t *testing.T) error {
+	l := listen(t)
+	_ = l.Close()
+	_, err := l.Accept()
+	return err
+}
+
+func deadlineError(t *testing.T) error {
+	client, _ := connPair(t)
+	if err := client.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("set deadline: %v", err)
+	}
+	_, err := client.Read(make([]byte, 1))
+	return err
+}
+
+func resetError(t *testing.T) error {
+	client, server := connPair(t)
+	if err := server.SetLinger(0); err != nil {
+		t.Fatalf("set linger: %v", err)
+	}
+	_ = server.Close()
+	if err := client.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("set deadline: %v", err)
+	}
+	_, err := client.Read(make([]byte, 1))
+	return err
+}
+
+func refusedError(t *testing.T) error {
+	l := listen(t)
+	addr := l.Addr().String()
+	_ = l.Close()
+	_, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	return err
+}
+
+func malformedError(t *testing.T) error {
+	// A handshake packet that ends inside its server address
+	packet := []byte{0x08, 0x00, 0x2f, 0x09, 'l', 'o', 'c', 'a', 'l'}
+	_, _, err := protocol.ParseHandshake(bufio.NewReader(bytes.NewReader(packet)))
+	return fmt.Errorf("failed to parse handshake: %w", err)
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           func(t *testing.T) error
+		class         errorClass
+		clientReason  closeReason
+		backendReason closeReason
+	}{
+		{"nil", func(*testing.T) error { return nil }, errorClassNone, closeClientEOF, closeBackendEOF},
+		{"eof", func(*testing.T) error { return io.EOF }, errorClassEOF, closeClientEOF, closeBackendEOF},
+		{"unexpected eof", func(*testing.T) error { return io.ErrUnexpectedEOF }, errorClassEOF, closeClientEOF, closeBackendEOF},
+		{"closed listener", closedListenerError, errorClassClosed, closeClientEOF, closeBackendEOF},
+		{"deadline", deadlineError, errorClassTimeout, closeTimeout, closeTimeout},
+		{"reset", resetError, errorClassReset, closeClientReset, closeBackendReset},
+		{"refused", refusedError, errorClassRefused, closeBackendUnavailable, closeBackendUnavailable},
+		{"malformed", malformedError, errorClassProtocol, closeProtocolError, closeProtocolError},
+		{"other", func(*testing.T) error { return fmt.Errorf("something else") }, errorClassOther, closeError, closeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err(t)
+			if tt.class != errorClassNone && err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := classifyError(err); got != tt.class {
+				t.Errorf("classifyError(%v) = %q, want %q", err, got, tt.class)
+			}
+			if got := closeReasonFor(true, err); got != tt.clientReason {
+				t.Errorf("closeReasonFor(client, %v) = %q, want %q", err, got, tt.clientReason)
+			}
+			if got := closeReasonFor(false, err); got != tt.backendReason {
+				t.Errorf("closeReasonFor(backend, %v) = %q, want %q", err, got, tt.backendReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package gateway
+
+import "syscall"
+
+var (
+	resetErrnos       = []syscall.Errno{syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE}
+	refusedErrnos     = []syscall.Errno{syscall.ECONNREFUSED}
+	unreachableErrnos = []syscall.Errno{syscall.ENETUNREACH, syscall.EHOSTUNREACH}
+)
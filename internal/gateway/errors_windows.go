@@ -0,0 +1,24 @@
+//go:build windows
+
+package gateway
+
+import "syscall"
+
+// Winsock reports its own error codes, the syscall.E* constants never match them
+const (
+	wsaeconnaborted = syscall.Errno(10053)
+	wsaeconnreset   = syscall.Errno(10054)
+	wsaeconnrefused = syscall.Errno(10061)
+	wsaenetunreach  = syscall.Errno(10051)
+	wsaehostunreach = syscall.Errno(10065)
+
+	errorConnectionRefused  = syscall.Errno(1225)
+	errorNetworkUnreachable = syscall.Errno(1231)
+	errorHostUnreachable    = syscall.Errno(1232)
+)
+
+var (
+	resetErrnos       = []syscall.Errno{wsaeconnreset, wsaeconnaborted, syscall.ERROR_NETNAME_DELETED, syscall.ERROR_BROKEN_PIPE}
+	refusedErrnos     = []syscall.Errno{wsaeconnrefused, errorConnectionRefused}
+	unreachableErrnos = []syscall.Errno{wsaenetunreach, wsaehostunreach, errorNetworkUnreachable, errorHostUnreachable}
+)
@@ -2,16 +2,16 @@ package gateway
 
 import (
 	"bufio"
+	"context"
 	"errors"
-	"io"
 	"net"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"minecraft-gateway/internal/config"
-	"minecraft-gateway/internal/logx"
-	"minecraft-gateway/internal/protocol"
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/logx"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
 )
 
 var logger = logx.GetLogger()
@@ -19,17 +19,59 @@ var logger = logx.GetLogger()
 type Gateway struct {
 	config      *config.Config
 	configMutex sync.RWMutex
-	listener    net.Listener
+
+	// One slot per connection in the handshake phase, connections beyond it are rejected
+	handshakeSlots chan struct{}
+
+	// Cached lookups of srv:// backends, circuit breakers and status responses of all backends
+	srv      *srvCache
+	breakers breakers
+	statuses statusCache
+
+	// Maintenance flags set at runtime, see SetMaintenance
+	maintenance atomic.Pointer[map[string]bool]
+
+	// Custom router and hooks of embedding programs, nil router means ConfigRouter
+	router Router
+	hooks  []Hooks
+
+	// Connection handlers still running, waited for by Shutdown. Handlers are only added while
+	// closing is false, both guarded by mu
+	mu       sync.Mutex
+	closing  bool
+	handlers sync.WaitGroup
+
+	// Cancelled by Shutdown to stop the listeners and interrupt connections not yet proxied
+	done   context.Context
+	cancel context.CancelFunc
+
+	// Number of proxied sessions past the status phase, reported as online players
+	activeSessions atomic.Int64
 }
 
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown was called.
+var ErrServerClosed = errors.New("gateway: server closed")
+
 func NewGateway(conf *config.Config) *Gateway {
-	return &Gateway{config: conf}
+	g := &Gateway{
+		config:         conf,
+		handshakeSlots: make(chan struct{}, conf.MaxHandshakes),
+		srv:            newSRVCache(dnsResolver{}),
+	}
+	g.done, g.cancel = context.WithCancel(context.Background())
+	return g
 }
 
+// UpdateConfig replaces the config of the gateway, connections accepted afterwards use it.
+// conf must have been prepared, as LoadConfig does.
 func (g *Gateway) UpdateConfig(conf *config.Config) {
 	g.configMutex.Lock()
 	defer g.configMutex.Unlock()
 	g.config = conf
+	// Connections holding a slot of the old channel release it there
+	if cap(g.handshakeSlots) != conf.MaxHandshakes {
+		g.handshakeSlots = make(chan struct{}, conf.MaxHandshakes)
+	}
 }
 
 func sendData(dst net.Conn, data []byte) error {
@@ -46,35 +88,83 @@ func sendData(dst net.Conn, data []byte) error {
 	return err
 }
 
-func isExpectedNetworkError(err error) bool {
-	if err == nil {
-		return false
+// setKeepAlive applies a TCP keepalive period to the connection, zero keeps the current
+// setting, the Go default of 15 seconds for listeners that did not change it, and a negative
+// period disables keepalives.
+func setKeepAlive(conn net.Conn, period time.Duration) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok || period == 0 {
+		return nil
 	}
+	if period < 0 {
+		return tcpConn.SetKeepAlive(false)
+	}
+	if err := tcpConn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return tcpConn.SetKeepAlivePeriod(period)
+}
 
-	errStr := err.Error()
-
-	expectedErrors := []string{
-		"use of closed network connection",
-		"connection reset by peer",
-		"broken pipe",
-		"EOF",
-		"connection refused",
-		"network is unreachable",
-		"no route to host",
+// forwardedHandshake returns the handshake bytes to send to the backend. The original bytes are
+// reused unless the server rewrites the host or port, strips the address marker or forwards player info.
+func forwardedHandshake(conf *config.Config, serverName string, handshake *protocol.HandshakePacket, data []byte, forwardingSuffix string) []byte {
+	rewriteHost, rewritePort := conf.GetHandshakeRewrite(serverName)
+	strip := handshake.AddressSuffix != "" && conf.StripAddressMarker(serverName)
+	if rewriteHost == "" && rewritePort == 0 && !strip && forwardingSuffix == "" {
+		return data
 	}
 
-	for _, expected := range expectedErrors {
-		if strings.Contains(errStr, expected) {
-			return true
-		}
+	forwarded := *handshake
+	if rewriteHost != "" {
+		forwarded.Host = rewriteHost
+	}
+	if rewritePort != 0 {
+		forwarded.ServerPort = rewritePort
+	}
+	if strip {
+		forwarded.AddressSuffix = ""
+		forwarded.ForgeMarker = ""
 	}
+	if forwardingSuffix != "" {
+		forwarded.AddressSuffix = forwardingSuffix
+	}
+	forwarded.ServerAddress = forwarded.Host + forwarded.AddressSuffix
+	return forwarded.Encode()
+}
+
+// fallbackHandshake returns the handshake bytes for a fallback server, forwarded as if the
+// client had connected to that server.
+func fallbackHandshake(conf *config.Config, fallbackServer string, handshake *protocol.HandshakePacket, forwardingSuffix string) []byte {
+	addressed := *handshake
+	addressed.Host = fallbackServer
+	addressed.ServerAddress = addressed.Host + addressed.AddressSuffix
+	return forwardedHandshake(conf, fallbackServer, &addressed, addressed.Encode(), forwardingSuffix)
+}
 
-	return false
+// bungeeCordSuffix builds the data BungeeCord appends to the handshake server address:
+// the client IP and the player UUID, each preceded by a NUL byte.
+func bungeeCordSuffix(clientAddr net.Addr, login *protocol.LoginStartPacket, uuidMode string) string {
+	clientIP := clientAddr.String()
+	if host, _, err := net.SplitHostPort(clientIP); err == nil {
+		clientIP = host
+	}
+	uuid := protocol.OfflineUUID(login.Name)
+	if uuidMode == config.ForwardingUUIDOnline && login.UUID != nil {
+		uuid = *login.UUID
+	}
+	return "\x00" + clientIP + "\x00" + uuid.Hex()
 }
 
-func (g *Gateway) handleConnection(clientConn net.Conn) {
+func (g *Gateway) handleConnection(ctx context.Context, clientConn net.Conn, handshakeSlots chan struct{}) {
+	sess := newSession(ctx, clientConn)
+	sess.handshakeSlots = handshakeSlots
+	reader := getReader(clientConn)
 	defer func() {
 		_ = clientConn.Close()
+		putReader(reader)
+		sess.end()
+		g.closed(sess)
+		g.handlers.Done()
 	}()
 
 	g.configMutex.RLock()
@@ -82,90 +172,357 @@ func (g *Gateway) handleConnection(clientConn net.Conn) {
 	g.configMutex.RUnlock()
 
 	clientAddr := clientConn.RemoteAddr()
-	reader := bufio.NewReader(clientConn)
 
-	// Check global whitelist first (before parsing anything)
-	tcpAddr, ok := clientAddr.(*net.TCPAddr)
-	if !ok {
-		logger.Warnf("Connection from non-TCP address: %s", clientAddr)
+	if err := g.accepted(clientConn); err != nil {
+		logger.Debugf("Connection from %s rejected by accept hook: %s", clientAddr, err)
+		sess.close(closeRejected, err)
+		return
+	}
+
+	if err := setKeepAlive(clientConn, conf.TCPKeepAlive.Client); err != nil {
+		logger.Debugf("Failed to set keepalive for %s: %s", clientAddr, err)
+	}
+
+	// Bound the time a client may take to send everything needed for routing
+	handshakeDeadline := time.Now().Add(conf.HandshakeTimeout)
+	if err := clientConn.SetReadDeadline(handshakeDeadline); err != nil {
+		logger.Debugf("Failed to set handshake deadline for %s: %s", clientAddr, err)
+		sess.close(closeError, err)
 		return
 	}
-	if !conf.IsAllowedByGlobal(tcpAddr.IP) {
-		logger.Debugf("Connection from %s is not allowed by global whitelist", tcpAddr.IP)
+	// Shutdown interrupts reading the handshake, routing and dialing, see session.establish
+	sess.stopInterrupt = context.AfterFunc(ctx, func() {
+		sess.interrupted.Store(true)
+		_ = clientConn.SetReadDeadline(time.Now())
+	})
+
+	// Check global whitelist first (before parsing anything). Whitelists only cover IP addresses,
+	// clients of Unix or in-memory listeners of embedding programs are let through like the
+	// listener itself, the same holds for server whitelists below
+	if tcpAddr, ok := clientAddr.(*net.TCPAddr); ok && !conf.IsAllowedByGlobal(tcpAddr.IP) {
+		logReject(rejectGlobalWhitelist, clientAddr, nil, "Connection from %s is not allowed by global whitelist", tcpAddr.IP)
+		sess.close(closeRejectedWhitelist, nil)
 		return
 	}
 
 	// Parse proxy protocol if enabled globally
 	if conf.ProxyProtocol.ReceiveFromDownstream {
+		span := sess.startSpan("proxy_protocol.parse")
 		header, err := protocol.ParseProxyProtocol(reader)
+		endSpan(span, err)
 		if err != nil {
-			logger.Errorf("Failed to parse proxy protocol header from %s: %s", clientAddr, err)
+			logReject(rejectProxyHeader, clientAddr, err, "Failed to parse proxy protocol header from %s: %s", clientAddr)
+			sess.fail(true, err)
 			return
 		}
 		clientAddr = header.SrcAddr
+		sess.proxySource = header.SrcAddr
 		logger.Debugf("Received proxy protocol header from %s", clientAddr)
 	}
 
+	// Answer or forward pre-1.7 server list pings
+	if legacy, err := isLegacyPing(sess, clientConn, reader, handshakeDeadline); err != nil {
+		logReject(rejectHandshake, clientAddr, err, "Failed to read first packet from %s: %s", clientAddr)
+		sess.fail(true, err)
+		return
+	} else if legacy {
+		g.handleLegacyPing(sess, clientConn, reader, clientAddr, conf)
+		return
+	}
+
 	// Parse handshake
+	span := sess.startSpan("handshake.parse")
 	handshake, data, err := protocol.ParseHandshake(reader)
+	endSpan(span, err)
 	if err != nil {
-		logger.Errorf("Failed to parse handshake from %s: %s", clientAddr, err)
+		logReject(rejectHandshake, clientAddr, err, "Failed to parse handshake from %s: %s", clientAddr)
+		sess.fail(true, err)
 		return
 	}
 	logger.Debugf("Received handshake from %s: %+v", clientAddr, handshake)
 
-	serverName := handshake.ServerAddress
-	if idx := strings.IndexByte(serverName, '\x00'); idx != -1 {
-		serverName = serverName[:idx]
+	serverName := handshake.Host
+	sess.serverName = serverName
+	sess.handshake = handshake
+	sess.protocolVersion = int32(handshake.ProtocolVersion)
+	sess.nextState = int32(handshake.NextState)
+
+	req := &RouteRequest{ClientAddr: clientAddr, Handshake: handshake}
+	if err := g.handshaken(req); err != nil {
+		logger.Debugf("Connection from %s rejected by handshake hook: %s", clientAddr, err)
+		sess.close(closeRejected, err)
+		return
 	}
 
 	// Check server-specific whitelist
+	span = sess.startSpan("route",
+		attrServerName.String(serverName),
+		attrProtocolVersion.Int(int(handshake.ProtocolVersion)),
+	)
 	if clientTCP, ok := clientAddr.(*net.TCPAddr); ok {
 		if !conf.IsAllowed(serverName, clientTCP.IP) {
-			logger.Debugf("Connection from %s is not allowed by whitelist for server %s", clientTCP.IP, serverName)
+			span.SetAttributes(attrCloseReason.String(string(closeRejectedWhitelist)))
+			span.End()
+			logReject(rejectServerWhitelist, clientAddr, nil, "Connection from %s is not allowed by whitelist for server %s", clientTCP.IP, serverName)
+			sess.close(closeRejectedWhitelist, nil)
 			return
 		}
 	}
 
-	// Get server address
-	backendAddr := conf.GetServerAddress(serverName)
+	// Pick the backend
+	router := g.router
+	if router == nil {
+		router = ConfigRouter(conf)
+	}
+	decision, err := router.Route(sess.ctx, req)
+	if err == nil {
+		decision, err = g.routed(req, decision)
+	}
+	if err != nil {
+		endSpan(span, err)
+		logger.Warnf("Failed to route connection from %s to server %s: %s", clientAddr, serverName, err)
+		sess.close(closeError, err)
+		return
+	}
+	backendAddr := decision.Backend
+	span.SetAttributes(attrBackend.String(backendAddr))
+	span.End()
+	if (decision.Drop || backendAddr == "") && !conf.HasServer(serverName) {
+		logReject(rejectUnknownHost, clientAddr, nil, "No backend for unknown server %q, rejecting %s", serverName, clientAddr)
+	}
+	if decision.Drop {
+		sess.close(closeDropped, nil)
+		return
+	}
 	if backendAddr == "" {
-		logger.Warnf("No backend selected for server address %s", serverName)
+		if conf.HasServer(serverName) {
+			logger.Infof("No backend for protocol version %d on server %s, rejecting %s", handshake.ProtocolVersion, serverName, clientAddr)
+		}
+		err := kickConnection(clientConn, reader, handshake, "Unsupported", decision.Message)
+		if err != nil {
+			logger.Debugf("Failed to send unsupported version response to %s: %s", clientAddr, err)
+		}
+		sess.close(closeKicked, err)
+		return
+	}
+
+	// Servers under maintenance answer status pings themselves and only let staff log in,
+	// bypassing by IP address is settled here and by username once the login start is read
+	maintenance := g.inMaintenance(conf, serverName)
+	if maintenance {
+		var clientIP net.IP
+		if clientTCP, ok := clientAddr.(*net.TCPAddr); ok {
+			clientIP = clientTCP.IP
+		}
+		maintenance = !conf.BypassesMaintenance(serverName, clientIP, "")
+	}
+	if maintenance && handshake.NextState == stateStatus {
+		kickMaintenance(sess, clientConn, reader, handshake, conf)
 		return
 	}
 
-	// Get proxy protocol config for this server
+	// Login start carries the username, BungeeCord forwarding and the maintenance bypass need it
+	// before the handshake can be sent. Otherwise it only names the player in the access log and
+	// a login start this gateway does not understand is forwarded as it is
+	var forwardingSuffix string
+	var loginData []byte
+	if handshake.NextState != stateStatus {
+		forwarding, uuidMode := conf.GetForwarding(serverName)
+		span := sess.startSpan("login_start.parse")
+		login, rawLogin, err := protocol.ParseLoginStart(reader, int32(handshake.ProtocolVersion))
+		endSpan(span, err)
+		loginData = rawLogin
+		switch {
+		case err == nil:
+			logger.Debugf("Received login start from %s: %s", clientAddr, login.Name)
+			sess.username = login.Name
+			sess.login = login
+		case rawLogin != nil && !maintenance && forwarding != config.ForwardingBungeeCord:
+			logger.Debugf("Forwarding login start from %s unparsed: %s", clientAddr, err)
+		default:
+			logReject(rejectLoginStart, clientAddr, err, "Failed to parse login start from %s: %s", clientAddr)
+			sess.fail(true, err)
+			return
+		}
+
+		if maintenance && !conf.BypassesMaintenance(serverName, nil, login.Name) {
+			kickMaintenance(sess, clientConn, reader, handshake, conf)
+			return
+		}
+
+		if forwarding == config.ForwardingBungeeCord {
+			forwardingSuffix = bungeeCordSuffix(clientAddr, login, uuidMode)
+		}
+	}
+
+	data = forwardedHandshake(conf, serverName, handshake, data, forwardingSuffix)
+
+	// Status pings may be answered without relaying them, pings no backend answered are relayed after all
+	if handshake.NextState == stateStatus {
+		if aggregate, _ := conf.GetStatusAggregate(serverName); aggregate != nil {
+			if g.serveAggregateStatus(sess, clientConn, reader, conf, serverName, data) {
+				return
+			}
+		} else if conf.StatusCache.Enabled && g.serveCachedStatus(sess, clientConn, reader, backendAddr, conf, serverName, data) {
+			return
+		}
+	}
+
+	if handshake.NextState != stateStatus {
+		g.activeSessions.Add(1)
+		defer g.activeSessions.Add(-1)
+	}
+
+	g.proxy(sess, clientConn, reader, clientAddr, backendAddr, conf, serverName, data, loginData)
+}
+
+// proxy dials the backend, replays the packets already read from the client and forwards traffic
+// in both directions until either side closes or a session timeout of the server expires.
+// An empty serverName uses the global settings.
+func (g *Gateway) proxy(sess *session, clientConn net.Conn, reader *bufio.Reader, clientAddr net.Addr, backendAddr string, conf *config.Config, serverName string, replay ...[]byte) {
+	sess.routed()
+	sess.backend = backendAddr
 	proxyProtocol := conf.GetProxyProtocol(serverName)
+	timeouts := conf.GetSessionTimeouts(serverName)
 
 	// Dial backend
-	logger.Infof("Routing connection from %s to backend %s", clientAddr, backendAddr)
-	backendConn, err := net.DialTimeout("tcp", backendAddr, conf.Timeout)
+	logger.Debugf("Routing connection from %s to backend %s", clientAddr, backendAddr)
+	span := sess.startSpan("backend.dial", attrBackend.String(backendAddr))
+	dialStart := time.Now()
+	backendConn, target, err := g.connectBackend(sess.ctx, conf, g.backendTargets(conf, serverName, backendAddr, sess.handshake))
+	sess.dialLatency = time.Since(dialStart)
+	backendAddr = target.addr
+	sess.backend = backendAddr
+	span.SetAttributes(attrBackend.String(backendAddr))
+	endSpan(span, err)
 	if err != nil {
-		logger.Errorf("Failed to connect to backend %s: %s", backendAddr, err)
+		// A dial cancelled by Shutdown leaves nobody to tell, a kick would wait on the client again
+		if sess.ctx.Err() != nil {
+			logger.Debugf("Connecting %s to backend %s interrupted by shutdown", clientAddr, backendAddr)
+			sess.close(closeShutdown, err)
+			return
+		}
+		if errors.Is(err, errBreakerOpen) {
+			logger.Debugf("Not connecting %s to backend %s: %s", clientAddr, backendAddr, err)
+		} else {
+			logger.Errorf("Failed to connect to backend %s: %s", backendAddr, err)
+		}
+		sess.close(closeBackendUnavailable, err)
+		// Tell the player instead of silently closing, legacy pings have no way to show it
+		if sess.handshake != nil {
+			if err := kickConnection(clientConn, reader, sess.handshake, "Unavailable", conf.CircuitBreaker.Message); err != nil {
+				logger.Debugf("Failed to send unavailable message to %s: %s", clientAddr, err)
+			}
+		}
 		return
 	}
 	defer func() {
 		_ = backendConn.Close()
 	}()
 
+	// A fallback server gets the handshake with its own forwarding and the session its own
+	// settings, it may also expect to be addressed by its own name. The handshake comes first
+	if target.server != "" && sess.handshake != nil {
+		proxyProtocol = conf.GetProxyProtocol(target.server)
+		timeouts = conf.GetSessionTimeouts(target.server)
+		var forwardingSuffix string
+		if forwarding, uuidMode := conf.GetForwarding(target.server); forwarding == config.ForwardingBungeeCord && sess.login != nil {
+			forwardingSuffix = bungeeCordSuffix(clientAddr, sess.login, uuidMode)
+		}
+		if _, rewrite := conf.GetFallback(serverName); rewrite {
+			logger.Debugf("Addressing handshake of %s to fallback server %s", clientAddr, target.server)
+			replay[0] = fallbackHandshake(conf, target.server, sess.handshake, forwardingSuffix)
+		} else {
+			replay[0] = forwardedHandshake(conf, target.server, sess.handshake, sess.handshake.Encode(), forwardingSuffix)
+		}
+	}
+
 	// Send proxy protocol header if enabled for this server
 	if proxyProtocol.SendToUpstream {
 		headerBytes, err := protocol.BuildProxyProtocolV1Header(clientAddr, backendConn.RemoteAddr())
 		if err != nil {
 			logger.Errorf("Failed to build proxy protocol header: %s", err)
+			sess.close(closeError, err)
 			return
 		}
 		if err := sendData(backendConn, headerBytes); err != nil {
 			logger.Errorf("Failed to send proxy protocol header to backend %s: %s", backendAddr, err)
+			sess.fail(false, err)
 			return
 		}
 	}
 
+	// Bytes the client sent after the handshake are still buffered, send them along so the rest
+	// of the session can be copied between the raw connections
+	buf := replayBuffers.get()
+	defer replayBuffers.put(buf)
+	data := *buf
+	for _, packet := range replay {
+		data = append(data, packet...)
+	}
+	if n := reader.Buffered(); n > 0 {
+		pending, _ := reader.Peek(n)
+		data = append(data, pending...)
+		_, _ = reader.Discard(n)
+	}
+	*buf = data
+
 	// Resend handshake data to backend
 	if err := sendData(backendConn, data); err != nil {
 		logger.Errorf("Failed to send handshake data to backend %s: %s", backendAddr, err)
+		sess.fail(false, err)
+		return
+	}
+	sess.bytesUp.Add(int64(len(data)))
+
+	span = sess.startSpan("proxy", attrBackend.String(backendAddr))
+	defer func() {
+		span.SetAttributes(
+			attrBytesUp.Int64(sess.bytesUp.Load()),
+			attrBytesDown.Int64(sess.bytesDown.Load()),
+		)
+		span.End()
+	}()
+
+	// Shutdown waits for established sessions instead of interrupting them
+	if !sess.establish() {
+		sess.close(closeShutdown, nil)
 		return
 	}
+	// The handshake deadline does not apply once the session is established
+	if err := clientConn.SetReadDeadline(time.Time{}); err != nil {
+		logger.Debugf("Failed to clear handshake deadline for %s: %s", clientAddr, err)
+		sess.close(closeError, err)
+		return
+	}
+
+	// The side that finishes first decides the close reason
+	var closeOnce sync.Once
+	finish := func(clientSide bool, err error) {
+		closeOnce.Do(func() {
+			sess.fail(clientSide, err)
+		})
+	}
+
+	// expire ends a session that ran into one of its timeouts
+	expire := func(reason closeReason) {
+		closeOnce.Do(func() {
+			sess.close(reason, nil)
+		})
+		logger.Debugf("Closing session of %s to backend %s: %s", clientAddr, backendAddr, reason)
+		_ = clientConn.Close()
+		_ = backendConn.Close()
+	}
+
+	if timeouts.MaxDuration > 0 {
+		maxDuration := time.AfterFunc(timeouts.MaxDuration-time.Since(sess.start), func() { expire(closeMaxDuration) })
+		defer maxDuration.Stop()
+	}
+
+	var idle *idleTracker
+	if timeouts.Idle > 0 {
+		idle = newIdleTracker(timeouts.Idle, clientConn, backendConn)
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -173,7 +530,14 @@ func (g *Gateway) handleConnection(clientConn net.Conn) {
 	// Forward client to backend
 	go func() {
 		defer wg.Done()
-		if _, err := io.Copy(backendConn, reader); err != nil {
+		n, err := forward(backendConn, clientConn, upstream, idle)
+		sess.bytesUp.Add(n)
+		if errors.Is(err, errSessionIdle) {
+			expire(closeIdleTimeout)
+			return
+		}
+		finish(true, err)
+		if err != nil {
 			if isExpectedNetworkError(err) {
 				return
 			}
@@ -187,7 +551,14 @@ func (g *Gateway) handleConnection(clientConn net.Conn) {
 	// Forward backend to client
 	go func() {
 		defer wg.Done()
-		if _, err := io.Copy(clientConn, backendConn); err != nil {
+		n, err := forward(clientConn, backendConn, downstream, idle)
+		sess.bytesDown.Add(n)
+		if errors.Is(err, errSessionIdle) {
+			expire(closeIdleTimeout)
+			return
+		}
+		finish(false, err)
+		if err != nil {
 			if isExpectedNetworkError(err) {
 				return
 			}
@@ -199,38 +570,110 @@ func (g *Gateway) handleConnection(clientConn net.Conn) {
 	}()
 
 	wg.Wait()
-	logger.Infof("Connection closed for %s", clientAddr)
+	logger.Debugf("Connection closed for %s", clientAddr)
 }
 
-func (g *Gateway) Start() error {
+// ListenAndServe listens on the configured address and serves connections until ctx is done or
+// Shutdown is called.
+func (g *Gateway) ListenAndServe(ctx context.Context) error {
+	g.configMutex.RLock()
+	listenAddr := g.config.ListenAddr
+	g.configMutex.RUnlock()
+
 	logger.Info("Starting gateway...")
-	listener, err := net.Listen("tcp", g.config.ListenAddr)
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "tcp", listenAddr)
 	if err != nil {
 		return err
 	}
-	g.listener = listener
-	logger.Infof("Gateway listening on %s", g.config.ListenAddr)
+	logger.Infof("Gateway listening on %s", listenAddr)
+	return g.Serve(ctx, listener)
+}
+
+// Serve accepts connections on the listener and closes it when ctx is done or Shutdown is called.
+// It returns ErrServerClosed after Shutdown, the error of ctx when ctx is done first, and the
+// accept error when the listener is closed by someone else. Connections still in the handshake
+// phase are interrupted once Serve returns, established sessions are left running.
+func (g *Gateway) Serve(ctx context.Context, listener net.Listener) error {
+	g.mu.Lock()
+	closing := g.closing
+	g.mu.Unlock()
+	if closing {
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopShutdown := context.AfterFunc(g.done, cancel)
+	defer stopShutdown()
+	stopListener := context.AfterFunc(ctx, func() {
+		_ = listener.Close()
+	})
+	defer stopListener()
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			var opErr *net.OpError
-			if errors.As(err, &opErr) && opErr.Op == "accept" {
-				if strings.Contains(err.Error(), "use of closed network connection") {
-					logger.Info("Listener closed, shutting down gracefully")
-					return nil
-				}
+			switch {
+			case g.done.Err() != nil:
+				logger.Info("Listener closed, shutting down gracefully")
+				return ErrServerClosed
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case errors.Is(err, net.ErrClosed):
+				return err
 			}
 			logger.Errorf("Failed to accept connection: %s", err)
 			continue
 		}
-		go g.handleConnection(conn)
+
+		g.configMutex.RLock()
+		handshakeSlots := g.handshakeSlots
+		g.configMutex.RUnlock()
+		select {
+		case handshakeSlots <- struct{}{}:
+			if !g.addHandler() {
+				<-handshakeSlots
+				_ = conn.Close()
+				continue
+			}
+			go g.handleConnection(ctx, conn, handshakeSlots)
+		default:
+			g.refuseOverloaded(conn)
+		}
 	}
 }
 
-func (g *Gateway) Stop() error {
-	if g.listener != nil {
-		return g.listener.Close()
+// addHandler registers a connection handler unless the gateway is shutting down.
+func (g *Gateway) addHandler() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closing {
+		return false
+	}
+	g.handlers.Add(1)
+	return true
+}
+
+// Shutdown closes the listeners, interrupts connections that are not proxied yet, including
+// backend dials, and waits until the established sessions end or ctx is done. Serve calls
+// started afterwards return ErrServerClosed right away.
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.closing = true
+	g.mu.Unlock()
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil
 }
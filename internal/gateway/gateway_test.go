@@ -0,0 +1,400 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+// testGateway is a gateway serving on a loopback listener, reporting closed sessions.
+type testGateway struct {
+	*Gateway
+	addr     string
+	served   chan error
+	sessions chan SessionInfo
+}
+
+func newTestConfig(t *testing.T, backend string) *config.Config {
+	t.Helper()
+	conf := &config.Config{
+		ListenAddr:       "127.0.0.1:0",
+		Timeout:          30 * time.Second,
+		HandshakeTimeout: 30 * time.Second,
+		Default:          backend,
+		Whitelist:        []string{"127.0.0.0/8"},
+	}
+	if err := conf.Prepare(); err != nil {
+		t.Fatalf("prepare config: %v", err)
+	}
+	return conf
+}
+
+func startGateway(t *testing.T, conf *config.Config) *testGateway {
+	t.Helper()
+	g := &testGateway{
+		Gateway:  NewGateway(conf),
+		served:   make(chan error, 1),
+		sessions: make(chan SessionInfo, 16),
+	}
+	g.Use(Hooks{OnClose: func(info SessionInfo) { g.sessions <- info }})
+	l := listen(t)
+	g.addr = l.Addr().String()
+	go func() { g.served <- g.Serve(context.Background(), l) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = g.Shutdown(ctx)
+	})
+	return g
+}
+
+func (g *testGateway) dial(t *testing.T) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", g.addr)
+	if err != nil {
+		t.Fatalf("dial gateway: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func (g *testGateway) serveResult(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-g.served:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+		return nil
+	}
+}
+
+func (g *testGateway) closedSession(t *testing.T) SessionInfo {
+	t.Helper()
+	select {
+	case info := <-g.sessions:
+		return info
+	case <-time.After(5 * time.Second):
+		t.Fatal("session was not closed")
+		return SessionInfo{}
+	}
+}
+
+func statusHandshake(host string) []byte {
+	h := &protocol.HandshakePacket{ProtocolVersion: 767, ServerAddress: host, ServerPort: 25565, NextState: stateStatus}
+	return h.Encode()
+}
+
+// waitClosed waits for the gateway to close conn.
+func waitClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("set deadline: %v", err)
+	}
+	for {
+		if _, err := conn.Read(make([]byte, 256)); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatal("connection was not closed")
+			}
+			return
+		}
+	}
+}
+
+func shutdown(t *testing.T, g *testGateway, timeout time.Duration) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return g.Shutdown(ctx)
+}
+
+func TestShutdownBeforeServe(t *testing.T) {
+	g := NewGateway(newTestConfig(t, "127.0.0.1:1"))
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	l := listen(t)
+	if err := g.Serve(context.Background(), l); !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("Serve() = %v, want ErrServerClosed", err)
+	}
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("listener still open after Serve returned: %v", err)
+	}
+}
+
+func TestShutdownInterruptsHandshake(t *testing.T) {
+	g := startGateway(t, newTestConfig(t, "127.0.0.1:1"))
+	conn := g.dial(t)
+	// Half a handshake, the gateway waits for the rest until its 30s handshake timeout
+	if _, err := conn.Write(statusHandshake("mc.example.com")[:4]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	if err := shutdown(t, g, 5*time.Second); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Shutdown took %s", elapsed)
+	}
+	if err := g.serveResult(t); !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("Serve() = %v, want ErrServerClosed", err)
+	}
+	waitClosed(t, conn)
+	if info := g.closedSession(t); info.CloseReason != string(closeShutdown) {
+		t.Fatalf("close reason = %q, want %q", info.CloseReason, closeShutdown)
+	}
+}
+
+func TestShutdownInterruptsBackendDial(t *testing.T) {
+	g := startGateway(t, newTestConfig(t, blackholeAddr(t)))
+	conn := g.dial(t)
+	if _, err := conn.Write(statusHandshake("mc.example.com")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if err := shutdown(t, g, 5*time.Second); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Shutdown took %s", elapsed)
+	}
+	if err := g.serveResult(t); !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("Serve() = %v, want ErrServerClosed", err)
+	}
+	if info := g.closedSession(t); info.CloseReason != string(closeShutdown) {
+		t.Fatalf("close reason = %q, want %q", info.CloseReason, closeShutdown)
+	}
+}
+
+func TestShutdownDeadlineWithOpenSession(t *testing.T) {
+	backend := listen(t)
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := backend.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	g := startGateway(t, newTestConfig(t, backend.Addr().String()))
+	conn := g.dial(t)
+	if _, err := conn.Write(statusHandshake("mc.example.com")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var backendConn net.Conn
+	select {
+	case backendConn = <-accepted:
+		defer backendConn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend was not dialed")
+	}
+	// The handshake is forwarded once the session is established
+	if err := backendConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("set deadline: %v", err)
+	}
+	if _, err := backendConn.Read(make([]byte, 256)); err != nil {
+		t.Fatalf("read forwarded handshake: %v", err)
+	}
+
+	// Proxied sessions are left to finish, so Shutdown runs into its deadline
+	if err := shutdown(t, g, 100*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() = %v, want context.DeadlineExceeded", err)
+	}
+	if err := g.serveResult(t); !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("Serve() = %v, want ErrServerClosed", err)
+	}
+
+	// The backend hangs up once it sees the client leave
+	_ = conn.Close()
+	waitClosed(t, backendConn)
+	_ = backendConn.Close()
+	if err := shutdown(t, g, 5*time.Second); err != nil {
+		t.Fatalf("Shutdown() after the session ended = %v", err)
+	}
+	if info := g.closedSession(t); info.CloseReason != string(closeClientEOF) {
+		t.Fatalf("close reason = %q, want %q", info.CloseReason, closeClientEOF)
+	}
+}
+
+// loginStart returns a login handshake for host followed by a 1.8 login start, which carries
+// only the username.
+func loginStart(host, name string) []byte {
+	h := &protocol.HandshakePacket{ProtocolVersion: 47, ServerAddress: host, ServerPort: 25565, NextState: 2}
+	body := append([]byte{0x00, byte(len(name))}, name...)
+	return append(append(h.Encode(), byte(len(body))), body...)
+}
+
+func TestFallbackUsesFallbackForwarding(t *testing.T) {
+	closed := listen(t)
+	closedAddr := closed.Addr().String()
+	_ = closed.Close()
+
+	backend := listen(t)
+	handshakes := make(chan *protocol.HandshakePacket, 1)
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handshake, _, err := protocol.ParseHandshake(bufio.NewReader(conn))
+		if err == nil {
+			handshakes <- handshake
+		}
+	}()
+
+	conf := &config.Config{
+		ListenAddr:       "127.0.0.1:0",
+		Timeout:          30 * time.Second,
+		HandshakeTimeout: 30 * time.Second,
+		Whitelist:        []string{"127.0.0.0/8"},
+		Servers: []config.Server{
+			{Name: "mc.example.com", Address: closedAddr, Fallback: []string{"lobby.example.com"}},
+			{Name: "lobby.example.com", Address: backend.Addr().String(), Forwarding: config.ForwardingBungeeCord},
+		},
+	}
+	if err := conf.Prepare(); err != nil {
+		t.Fatalf("prepare config: %v", err)
+	}
+	g := startGateway(t, conf)
+	conn := g.dial(t)
+	if _, err := conn.Write(loginStart("mc.example.com", "Steve")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	select {
+	case handshake := <-handshakes:
+		if handshake.Host != "mc.example.com" {
+			t.Fatalf("fallback got host %q, want the one the client asked for", handshake.Host)
+		}
+		want := "\x00127.0.0.1\x00" + protocol.OfflineUUID("Steve").Hex()
+		if handshake.AddressSuffix != want {
+			t.Fatalf("fallback got address suffix %q, want %q", handshake.AddressSuffix, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fallback was not dialed")
+	}
+}
+
+func TestBackendTargetsSkipMaintenance(t *testing.T) {
+	conf := &config.Config{
+		ListenAddr: "127.0.0.1:0",
+		Servers: []config.Server{
+			{Name: "mc.example.com", Address: "10.0.0.1:25565", Fallback: []string{"event.example.com", "lobby.example.com"}},
+			{Name: "event.example.com", Address: "10.0.0.2:25565", Maintenance: config.MaintenanceConfig{Enabled: true}},
+			{Name: "lobby.example.com", Address: "10.0.0.3:25565"},
+		},
+	}
+	if err := conf.Prepare(); err != nil {
+		t.Fatalf("prepare config: %v", err)
+	}
+	g := NewGateway(conf)
+	handshake := &protocol.HandshakePacket{ProtocolVersion: 767, Host: "mc.example.com"}
+
+	targets := g.backendTargets(conf, "mc.example.com", "10.0.0.1:25565", handshake)
+	want := []backendTarget{{addr: "10.0.0.1:25565"}, {server: "lobby.example.com", addr: "10.0.0.3:25565"}}
+	if len(targets) != len(want) {
+		t.Fatalf("backendTargets() = %v, want %v", targets, want)
+	}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Fatalf("backendTargets() = %v, want %v", targets, want)
+		}
+	}
+}
+
+func TestUnparsedLoginStartForwarded(t *testing.T) {
+	backend := listen(t)
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var data []byte
+		buf := make([]byte, 512)
+		for {
+			n, err := conn.Read(buf)
+			data = append(data, buf[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		received <- data
+	}()
+
+	g := startGateway(t, newTestConfig(t, backend.Addr().String()))
+	conn := g.dial(t)
+	// Usernames are at most 16 characters
+	sent := loginStart("mc.example.com", "AnUnusuallyLongName")
+	if _, err := conn.Write(sent); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	_ = conn.(*net.TCPConn).CloseWrite()
+
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, sent) {
+			t.Fatalf("backend received %q, want %q", data, sent)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("login was not forwarded")
+	}
+}
+
+func TestUnparsedLoginStartRejectedForBungeeCord(t *testing.T) {
+	conf := &config.Config{
+		ListenAddr:       "127.0.0.1:0",
+		Timeout:          30 * time.Second,
+		HandshakeTimeout: 30 * time.Second,
+		Whitelist:        []string{"127.0.0.0/8"},
+		Servers: []config.Server{
+			{Name: "mc.example.com", Address: "127.0.0.1:1", Forwarding: config.ForwardingBungeeCord},
+		},
+	}
+	if err := conf.Prepare(); err != nil {
+		t.Fatalf("prepare config: %v", err)
+	}
+	g := startGateway(t, conf)
+	conn := g.dial(t)
+	if _, err := conn.Write(loginStart("mc.example.com", "AnUnusuallyLongName")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	waitClosed(t, conn)
+	if info := g.closedSession(t); info.CloseReason != string(closeProtocolError) {
+		t.Fatalf("close reason = %q, want %q", info.CloseReason, closeProtocolError)
+	}
+}
+
+func TestOverloadedRefusedWithoutSession(t *testing.T) {
+	conf := newTestConfig(t, "127.0.0.1:1")
+	conf.MaxHandshakes = 1
+	g := startGateway(t, conf)
+	// The first client holds the only handshake slot by never sending its handshake
+	g.dial(t)
+	time.Sleep(50 * time.Millisecond)
+
+	conn := g.dial(t)
+	waitClosed(t, conn)
+	info := g.closedSession(t)
+	if info.CloseReason != string(closeOverloaded) {
+		t.Fatalf("close reason = %q, want %q", info.CloseReason, closeOverloaded)
+	}
+	if info.ID != "" {
+		t.Fatalf("refused connection got session ID %q", info.ID)
+	}
+}
@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"net"
+	"time"
+)
+
+// Hooks observe and filter connections at each stage. Every field is optional. Hooks
+// registered with Use run in registration order.
+type Hooks struct {
+	// OnAccept is called for each accepted connection, an error closes it.
+	OnAccept func(conn net.Conn) error
+	// OnHandshake is called once the handshake has been read, an error closes the connection.
+	OnHandshake func(req *RouteRequest) error
+	// OnRoute is called with the routing decision and returns the decision to apply.
+	OnRoute func(req *RouteRequest, decision Decision) (Decision, error)
+	// OnClose is called after a connection has been closed.
+	OnClose func(info SessionInfo)
+}
+
+// SessionInfo summarizes a closed connection, it carries the fields of its access log record.
+type SessionInfo struct {
+	ID              string
+	ClientAddr      net.Addr
+	ProxySource     net.Addr
+	ServerName      string
+	ProtocolVersion int32
+	NextState       int32
+	Username        string
+	Backend         string
+	DialLatency     time.Duration
+	Duration        time.Duration
+	BytesUp         int64
+	BytesDown       int64
+	CloseReason     string
+	Err             error
+}
+
+// Use registers hooks. It must be called before the gateway starts serving.
+func (g *Gateway) Use(hooks Hooks) {
+	g.hooks = append(g.hooks, hooks)
+}
+
+// SetRouter replaces the config based router. It must be called before the gateway starts serving.
+func (g *Gateway) SetRouter(router Router) {
+	g.router = router
+}
+
+func (g *Gateway) accepted(conn net.Conn) error {
+	for _, h := range g.hooks {
+		if h.OnAccept == nil {
+			continue
+		}
+		if err := h.OnAccept(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Gateway) handshaken(req *RouteRequest) error {
+	for _, h := range g.hooks {
+		if h.OnHandshake == nil {
+			continue
+		}
+		if err := h.OnHandshake(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Gateway) routed(req *RouteRequest, decision Decision) (Decision, error) {
+	for _, h := range g.hooks {
+		if h.OnRoute == nil {
+			continue
+		}
+		var err error
+		if decision, err = h.OnRoute(req, decision); err != nil {
+			return decision, err
+		}
+	}
+	return decision, nil
+}
+
+func (g *Gateway) closed(sess *session) {
+	if len(g.hooks) == 0 {
+		return
+	}
+	info := sess.info()
+	for _, h := range g.hooks {
+		if h.OnClose != nil {
+			h.OnClose(info)
+		}
+	}
+}
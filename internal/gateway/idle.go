@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// errSessionIdle is returned by forward when neither direction of a session carried traffic
+// for the idle timeout.
+var errSessionIdle = errors.New("session idle")
+
+const (
+	upstream = iota
+	downstream
+)
+
+// idleTracker detects idle sessions while both directions are copied by the kernel. Splice
+// only reports progress when a copy returns, so each direction copies in rounds ending at a
+// read deadline. A direction that found no traffic during its round interrupts the round of
+// the other one, which then decides with up to date information on both sides.
+type idleTracker struct {
+	timeout time.Duration
+	// Source connection of each direction
+	src [2]net.Conn
+	// End of the last round that carried traffic, in Unix nanoseconds
+	activeAt [2]atomic.Int64
+	// When the other direction last interrupted a round, in Unix nanoseconds
+	pokedAt [2]atomic.Int64
+	// Set once a direction stopped copying, a half-closed session idles on the remaining one
+	done [2]atomic.Bool
+}
+
+func newIdleTracker(timeout time.Duration, clientConn, backendConn net.Conn) *idleTracker {
+	t := &idleTracker{timeout: timeout, src: [2]net.Conn{clientConn, backendConn}}
+	now := time.Now().UnixNano()
+	t.activeAt[upstream].Store(now)
+	t.activeAt[downstream].Store(now)
+	return t
+}
+
+func (t *idleTracker) quiet(dir int, now time.Time) bool {
+	return now.Sub(time.Unix(0, t.activeAt[dir].Load())) >= t.timeout
+}
+
+// forward copies src to dst until src is done. The raw connections are copied directly so
+// Linux can splice between TCP sockets without passing the data through user space.
+func forward(dst, src net.Conn, dir int, idle *idleTracker) (int64, error) {
+	if idle == nil {
+		return copyConn(dst, src)
+	}
+	other := 1 - dir
+	var total int64
+	for {
+		roundStart := time.Now()
+		if err := src.SetReadDeadline(roundStart.Add(idle.timeout)); err != nil {
+			return total, err
+		}
+		n, err := copyConn(dst, src)
+		total += n
+		now := time.Now()
+		if n > 0 {
+			idle.activeAt[dir].Store(now.UnixNano())
+		}
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			idle.done[dir].Store(true)
+			return total, err
+		}
+		if n > 0 || !idle.quiet(dir, now) {
+			continue
+		}
+		if idle.done[other].Load() {
+			return total, errSessionIdle
+		}
+		// Interrupted by the other direction after it found no traffic itself
+		if idle.pokedAt[dir].Load() >= roundStart.UnixNano() && idle.quiet(other, now) {
+			return total, errSessionIdle
+		}
+		idle.pokedAt[other].Store(now.UnixNano())
+		_ = idle.src[other].SetReadDeadline(now)
+	}
+}
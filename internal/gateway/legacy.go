@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"time"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+// legacyPingWait is how long a client whose first byte is 0xFE gets for the next one before it is
+// taken for a legacy client waiting for the answer to its ping.
+const legacyPingWait = 500 * time.Millisecond
+
+// isLegacyPing tells a legacy ping from a handshake, see protocol.IsLegacyPing. The handshake
+// deadline applies again afterwards, unless Shutdown interrupted the connection meanwhile.
+func isLegacyPing(sess *session, clientConn net.Conn, reader *bufio.Reader, handshakeDeadline time.Time) (bool, error) {
+	var waited bool
+	legacy, err := protocol.IsLegacyPing(reader, func() {
+		waited = true
+		deadline := time.Now().Add(legacyPingWait)
+		if deadline.After(handshakeDeadline) {
+			deadline = handshakeDeadline
+		}
+		_ = clientConn.SetReadDeadline(deadline)
+	})
+	if !waited {
+		return legacy, err
+	}
+	if err := clientConn.SetReadDeadline(handshakeDeadline); err != nil {
+		return false, err
+	}
+	// The interrupt sets its deadline after marking the session, one of the two sees the other
+	if sess.interrupted.Load() {
+		_ = clientConn.SetReadDeadline(time.Now())
+		return false, os.ErrDeadlineExceeded
+	}
+	return legacy, err
+}
+
+// handleLegacyPing answers, forwards or drops a pre-1.7 server list ping.
+func (g *Gateway) handleLegacyPing(sess *session, clientConn net.Conn, reader *bufio.Reader, clientAddr net.Addr, conf *config.Config) {
+	ping, data, err := protocol.ParseLegacyPing(reader)
+	if err != nil {
+		logReject(rejectLegacyPing, clientAddr, err, "Failed to parse legacy ping from %s: %s", clientAddr)
+		sess.fail(true, err)
+		return
+	}
+	sess.serverName = ping.Host
+	sess.protocolVersion = ping.ProtocolVersion
+	sess.nextState = stateStatus
+	logger.Debugf("Received legacy ping from %s: %+v", clientAddr, ping)
+
+	switch conf.LegacyPing.Action {
+	case config.LegacyPingDrop:
+		sess.close(closeDropped, nil)
+		return
+	case config.LegacyPingForward:
+		g.proxy(sess, clientConn, reader, clientAddr, conf.Default, conf, "", data)
+		return
+	}
+
+	status := protocol.LegacyStatus{
+		ProtocolVersion: conf.LegacyPing.ProtocolVersion,
+		VersionName:     conf.LegacyPing.VersionName,
+		MOTD:            conf.LegacyPing.MOTD,
+		Online:          int(g.activeSessions.Load()),
+		Max:             *conf.LegacyPing.MaxPlayers,
+	}
+	var response bytes.Buffer
+	_ = protocol.WriteLegacyKick(&response, ping, status)
+	err = sendData(clientConn, response.Bytes())
+	if err != nil {
+		logger.Debugf("Failed to send legacy ping response to %s: %s", clientAddr, err)
+	}
+	sess.close(closeKicked, err)
+}
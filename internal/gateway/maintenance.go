@@ -0,0 +1,41 @@
+package gateway
+
+import (
+	"bufio"
+	"net"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+// SetMaintenance overrides the maintenance flag of servers by name, servers missing from
+// state keep the flag of the config.
+func (g *Gateway) SetMaintenance(state map[string]bool) {
+	g.maintenance.Store(&state)
+}
+
+// inMaintenance reports whether the given server is under maintenance.
+func (g *Gateway) inMaintenance(conf *config.Config, serverName string) bool {
+	if state := g.maintenance.Load(); state != nil {
+		if enabled, ok := (*state)[serverName]; ok {
+			return enabled
+		}
+	}
+	return conf.GetMaintenance(serverName).Enabled
+}
+
+// kickMaintenance answers a client of a server under maintenance, status pings get the
+// maintenance MOTD and logins are disconnected with the maintenance message.
+func kickMaintenance(sess *session, clientConn net.Conn, reader *bufio.Reader, handshake *protocol.HandshakePacket, conf *config.Config) {
+	maintenance := conf.GetMaintenance(sess.serverName)
+	text := maintenance.Message
+	if handshake.NextState == stateStatus {
+		text = maintenance.MOTD
+	}
+	logger.Debugf("Server %s is under maintenance, rejecting %s", sess.serverName, sess.clientAddr)
+	err := kickConnection(clientConn, reader, handshake, maintenance.VersionName, text)
+	if err != nil {
+		logger.Debugf("Failed to send maintenance response to %s: %s", sess.clientAddr, err)
+	}
+	sess.close(closeMaintenance, err)
+}
@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"net"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/logx"
+)
+
+// rejectKind is a kind of connection the gateway refuses before routing. Scanners produce
+// these in bulk, so each kind is sampled on its own.
+type rejectKind int
+
+const (
+	rejectGlobalWhitelist rejectKind = iota
+	rejectServerWhitelist
+	rejectProxyHeader
+	rejectHandshake
+	rejectLoginStart
+	rejectLegacyPing
+	rejectOverloaded
+	rejectUnknownHost
+)
+
+var rejectSamplers = [...]*logx.Sampler{
+	rejectGlobalWhitelist: logx.NewSampler("global whitelist rejections"),
+	rejectServerWhitelist: logx.NewSampler("server whitelist rejections"),
+	rejectProxyHeader:     logx.NewSampler("proxy protocol errors"),
+	rejectHandshake:       logx.NewSampler("handshake errors"),
+	rejectLoginStart:      logx.NewSampler("login start errors"),
+	rejectLegacyPing:      logx.NewSampler("legacy ping errors"),
+	rejectOverloaded:      logx.NewSampler("connections over the handshake limit"),
+	rejectUnknownHost:     logx.NewSampler("connections to unknown servers"),
+}
+
+// logReject logs a refused connection unless its kind is over the sampling limit. Whitelist
+// rejections and clients that simply went away are logged at debug level, malformed data at warn.
+func logReject(kind rejectKind, clientAddr net.Addr, err error, template string, args ...any) {
+	clientIP, _ := splitAddr(clientAddr)
+	if !rejectSamplers[kind].Allow(clientIP) {
+		return
+	}
+	if err != nil {
+		args = append(args, err)
+	}
+	switch {
+	case kind == rejectGlobalWhitelist, kind == rejectServerWhitelist, kind == rejectLegacyPing, kind == rejectUnknownHost:
+		logger.Debugf(template, args...)
+	case classifyError(err).expected():
+		logger.Debugf(template, args...)
+	default:
+		logger.Warnf(template, args...)
+	}
+}
@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+const (
+	replayBufferSize = 4096
+	copyBufferSize   = 32 * 1024
+
+	// Buffers grown past this size are left to the garbage collector
+	maxPooledBufferSize = 64 * 1024
+)
+
+var readerPool = sync.Pool{
+	New: func() any {
+		return bufio.NewReader(nil)
+	},
+}
+
+// getReader returns a pooled reader reading from r.
+func getReader(r io.Reader) *bufio.Reader {
+	reader := readerPool.Get().(*bufio.Reader)
+	reader.Reset(r)
+	return reader
+}
+
+func putReader(reader *bufio.Reader) {
+	reader.Reset(nil)
+	readerPool.Put(reader)
+}
+
+// bufferPool holds the buffers used to replay the handshake to the backend and, where
+// the kernel cannot splice, to copy session traffic.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func newBufferPool(size int) *bufferPool {
+	return &bufferPool{pool: sync.Pool{
+		New: func() any {
+			buf := make([]byte, 0, size)
+			return &buf
+		},
+	}}
+}
+
+func (p *bufferPool) get() *[]byte {
+	return p.pool.Get().(*[]byte)
+}
+
+func (p *bufferPool) put(buf *[]byte) {
+	if cap(*buf) > maxPooledBufferSize {
+		return
+	}
+	*buf = (*buf)[:0]
+	p.pool.Put(buf)
+}
+
+var (
+	replayBuffers = newBufferPool(replayBufferSize)
+	copyBuffers   = newBufferPool(copyBufferSize)
+)
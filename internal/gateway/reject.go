@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"bufio"
+	"net"
+	"time"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+const (
+	stateStatus = 1
+
+	rejectTimeout = 5 * time.Second
+)
+
+// refuseOverloaded closes a connection accepted while all handshake slots are taken. Shedding load
+// has to stay cheap, the connection is only reported to the access log and close hooks, without a
+// session ID or span.
+func (g *Gateway) refuseOverloaded(clientConn net.Conn) {
+	_ = clientConn.Close()
+	sess := &session{
+		start:      time.Now(),
+		clientAddr: clientConn.RemoteAddr(),
+		listener:   clientConn.LocalAddr(),
+		reason:     closeOverloaded,
+	}
+	logReject(rejectOverloaded, sess.clientAddr, nil, "Too many connections in the handshake phase, rejecting %s", sess.clientAddr)
+	sess.log()
+	g.closed(sess)
+}
+
+// kickConnection answers the client directly instead of routing it to a backend.
+// Status pings receive a response showing the message, login attempts are disconnected with it.
+func kickConnection(clientConn net.Conn, reader *bufio.Reader, handshake *protocol.HandshakePacket, versionName, message string) error {
+	if err := clientConn.SetDeadline(time.Now().Add(rejectTimeout)); err != nil {
+		return err
+	}
+
+	if handshake.NextState == stateStatus {
+		return protocol.ServeStatus(reader, clientConn, &protocol.StatusResponse{
+			Version: protocol.StatusVersion{
+				Name:     versionName,
+				Protocol: -1,
+			},
+			Description: protocol.TextComponent(message),
+		})
+	}
+	return protocol.WriteLoginDisconnect(clientConn, message)
+}
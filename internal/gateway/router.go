@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"context"
+	"net"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+// RouteRequest describes a connection waiting for a routing decision.
+type RouteRequest struct {
+	// ClientAddr is the client address, taken from the PROXY header when one was received.
+	ClientAddr net.Addr
+	Handshake  *protocol.HandshakePacket
+}
+
+// Decision is the outcome of routing a connection.
+type Decision struct {
+	// Backend is the address to proxy the connection to, an empty address rejects it.
+	Backend string
+	// Message is shown to rejected clients in the server list or as the disconnect reason.
+	Message string
+	// Drop closes the connection without answering, it takes precedence over Backend.
+	Drop bool
+}
+
+// Router picks the backend for a connection once its handshake has been read.
+type Router interface {
+	Route(ctx context.Context, req *RouteRequest) (Decision, error)
+}
+
+// RouterFunc adapts a function to the Router interface.
+type RouterFunc func(ctx context.Context, req *RouteRequest) (Decision, error)
+
+func (f RouterFunc) Route(ctx context.Context, req *RouteRequest) (Decision, error) {
+	return f(ctx, req)
+}
+
+// configRouter routes with the servers and routes of a config.
+type configRouter struct {
+	conf *config.Config
+}
+
+// ConfigRouter returns the router used by default, which matches the handshake host against
+// the configured servers and their routes. Unknown hosts are handled by the unknown host action,
+// routing sends them to the default backend.
+func ConfigRouter(conf *config.Config) Router {
+	return configRouter{conf: conf}
+}
+
+func (r configRouter) Route(_ context.Context, req *RouteRequest) (Decision, error) {
+	handshake := req.Handshake
+	if !r.conf.HasServer(handshake.Host) {
+		switch r.conf.UnknownHostAction {
+		case config.UnknownHostDrop:
+			return Decision{Drop: true}, nil
+		case config.UnknownHostStatusOnly:
+			if handshake.NextState != stateStatus {
+				return Decision{Drop: true}, nil
+			}
+			return Decision{Message: r.conf.UnknownHostMessage}, nil
+		case config.UnknownHostDisconnect:
+			return Decision{Message: r.conf.UnknownHostMessage}, nil
+		}
+	}
+	backend := r.conf.GetServerAddress(handshake.Host, int32(handshake.ProtocolVersion), handshake.IsModded())
+	if backend == "" {
+		return Decision{Message: r.conf.GetUnsupportedMessage(handshake.Host)}, nil
+	}
+	return Decision{Backend: backend}, nil
+}
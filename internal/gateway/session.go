@@ -0,0 +1,237 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/logx"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+	"github.com/SmallL-U/minecraft-gateway/internal/tracing"
+)
+
+var accessLogger = logx.GetAccessLogger()
+
+// closeReason tells why a session ended, it is recorded in the access log.
+type closeReason string
+
+const (
+	closeClientEOF          closeReason = "client_eof"
+	closeBackendEOF         closeReason = "backend_eof"
+	closeClientReset        closeReason = "client_reset"
+	closeBackendReset       closeReason = "backend_reset"
+	closeTimeout            closeReason = "timeout"
+	closeIdleTimeout        closeReason = "idle_timeout"
+	closeMaxDuration        closeReason = "max_session_duration"
+	closeProtocolError      closeReason = "protocol_error"
+	closeBackendUnavailable closeReason = "backend_unavailable"
+	closeError              closeReason = "error"
+	closeKicked             closeReason = "kicked"
+	closeRejectedWhitelist  closeReason = "rejected_whitelist"
+	closeRejected           closeReason = "rejected"
+	closeDropped            closeReason = "dropped"
+	closeOverloaded         closeReason = "overloaded"
+	closeShutdown           closeReason = "shutdown"
+	closeMaintenance        closeReason = "maintenance"
+	closeStatusCached       closeReason = "status_cached"
+	closeStatusAggregated   closeReason = "status_aggregated"
+)
+
+// session collects what happened to a client connection and writes it as a single
+// access log record when the connection closes.
+type session struct {
+	id          string
+	start       time.Time
+	clientAddr  net.Addr
+	proxySource net.Addr
+	listener    net.Addr
+
+	handshake       *protocol.HandshakePacket // nil for legacy pings
+	serverName      string
+	protocolVersion int32
+	nextState       int32
+	username        string
+	// Login start of the player, kept to readdress the handshake to a fallback, nil for status pings
+	login       *protocol.LoginStartPacket
+	backend     string
+	dialLatency time.Duration
+
+	bytesUp   atomic.Int64
+	bytesDown atomic.Int64
+
+	reason closeReason
+	err    error
+
+	// Slot held until the session is routed, nil once released
+	handshakeSlots chan struct{}
+
+	// Interrupts the connection on shutdown until the session is established
+	stopInterrupt func() bool
+	interrupted   atomic.Bool
+
+	// Root span of the session, phases are recorded as its children
+	ctx  context.Context
+	span trace.Span
+}
+
+func newSession(ctx context.Context, clientConn net.Conn) *session {
+	s := &session{
+		id:         newSessionID(),
+		start:      time.Now(),
+		clientAddr: clientConn.RemoteAddr(),
+		listener:   clientConn.LocalAddr(),
+	}
+	s.ctx, s.span = tracing.Tracer(tracerName).Start(ctx, "session",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attrSessionID.String(s.id),
+			attrClientAddress.String(addrString(s.clientAddr)),
+		),
+	)
+	return s
+}
+
+func newSessionID() string {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// close records why the session ended, only the first reason is kept.
+func (s *session) close(reason closeReason, err error) {
+	if s.reason != "" {
+		return
+	}
+	s.reason = reason
+	s.err = err
+}
+
+// fail records an error on the client or backend side as the reason the session ended.
+func (s *session) fail(clientSide bool, err error) {
+	s.close(closeReasonFor(clientSide, err), err)
+}
+
+// routed releases the handshake slot of the session.
+func (s *session) routed() {
+	if s.handshakeSlots != nil {
+		<-s.handshakeSlots
+		s.handshakeSlots = nil
+	}
+}
+
+// establish stops shutdown from interrupting the session, it reports false if that already happened.
+func (s *session) establish() bool {
+	return s.stopInterrupt == nil || s.stopInterrupt()
+}
+
+// end writes the access log record for the session and ends its span.
+func (s *session) end() {
+	s.routed()
+	s.establish()
+	// Whatever failed after the interrupt failed because of it
+	if s.interrupted.Load() {
+		s.reason, s.err = closeShutdown, nil
+	}
+	if s.reason == "" {
+		s.reason = closeError
+	}
+	s.log()
+
+	s.span.SetAttributes(
+		attrServerName.String(s.serverName),
+		attrProtocolVersion.Int(int(s.protocolVersion)),
+		attrNextState.Int(int(s.nextState)),
+		attrUsername.String(s.username),
+		attrBackend.String(s.backend),
+		attrBytesUp.Int64(s.bytesUp.Load()),
+		attrBytesDown.Int64(s.bytesDown.Load()),
+		attrCloseReason.String(string(s.reason)),
+	)
+	if s.err != nil && !classifyError(s.err).expected() {
+		endSpan(s.span, s.err)
+		return
+	}
+	s.span.End()
+}
+
+// log writes the access log record for the session.
+func (s *session) log() {
+	// Skip building the fields when the access log level filters the record out
+	entry := accessLogger.Check(zap.InfoLevel, "session closed")
+	if entry == nil {
+		return
+	}
+	clientIP, clientPort := splitAddr(s.clientAddr)
+	fields := []zap.Field{
+		zap.String("session_id", s.id),
+		zap.String("client_ip", clientIP),
+		zap.Int("client_port", clientPort),
+		zap.String("listener", addrString(s.listener)),
+		zap.String("server", s.serverName),
+		zap.Int32("protocol_version", s.protocolVersion),
+		zap.Int32("next_state", s.nextState),
+		zap.String("username", s.username),
+		zap.String("backend", s.backend),
+		zap.Duration("dial_latency", s.dialLatency),
+		zap.Duration("duration", time.Since(s.start)),
+		zap.Int64("bytes_up", s.bytesUp.Load()),
+		zap.Int64("bytes_down", s.bytesDown.Load()),
+		zap.String("close_reason", string(s.reason)),
+	}
+	if s.proxySource != nil {
+		fields = append(fields, zap.String("proxy_source", s.proxySource.String()))
+	}
+	if s.err != nil {
+		fields = append(fields,
+			zap.String("error_class", string(classifyError(s.err))),
+			zap.String("error", s.err.Error()),
+		)
+	}
+	entry.Write(fields...)
+}
+
+// info returns the summary of the session passed to close hooks.
+func (s *session) info() SessionInfo {
+	return SessionInfo{
+		ID:              s.id,
+		ClientAddr:      s.clientAddr,
+		ProxySource:     s.proxySource,
+		ServerName:      s.serverName,
+		ProtocolVersion: s.protocolVersion,
+		NextState:       s.nextState,
+		Username:        s.username,
+		Backend:         s.backend,
+		DialLatency:     s.dialLatency,
+		Duration:        time.Since(s.start),
+		BytesUp:         s.bytesUp.Load(),
+		BytesDown:       s.bytesDown.Load(),
+		CloseReason:     string(s.reason),
+		Err:             s.err,
+	}
+}
+
+func splitAddr(addr net.Addr) (string, int) {
+	if addr == nil {
+		return "", 0
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String(), 0
+	}
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
@@ -0,0 +1,220 @@
+package gateway
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// SRV records looked up for srv:// backends, the same ones Minecraft clients use
+	srvService = "minecraft"
+	srvProto   = "tcp"
+
+	// srvMinTTL bounds how often a name is looked up again, it also applies when no TTL was seen
+	srvMinTTL = 5 * time.Second
+)
+
+// srvResolver looks up the SRV records of a name together with how long they may be cached.
+type srvResolver interface {
+	LookupSRV(ctx context.Context, name string) ([]*net.SRV, time.Duration, error)
+}
+
+// dnsResolver resolves SRV records with the Go resolver, which honours the system config and
+// search domains. net.Resolver does not return TTLs, so they are read from the responses
+// passing through the connections it dials.
+type dnsResolver struct{}
+
+func (dnsResolver) LookupSRV(ctx context.Context, name string) ([]*net.SRV, time.Duration, error) {
+	ttl := &ttlRecorder{}
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &ttlConn{Conn: conn, stream: strings.HasPrefix(network, "tcp"), ttl: ttl}, nil
+		},
+	}
+	_, records, err := resolver.LookupSRV(ctx, srvService, srvProto, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, ttl.get(), nil
+}
+
+// ttlRecorder keeps the lowest TTL of the SRV answers seen during a lookup.
+type ttlRecorder struct {
+	mu   sync.Mutex
+	seen bool
+	min  uint32
+}
+
+func (r *ttlRecorder) observe(msg []byte) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(msg)
+	if err != nil || header.RCode != dnsmessage.RCodeSuccess {
+		return
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for {
+		answer, err := parser.AnswerHeader()
+		if err != nil {
+			return
+		}
+		if answer.Type == dnsmessage.TypeSRV && (!r.seen || answer.TTL < r.min) {
+			r.seen, r.min = true, answer.TTL
+		}
+		if err := parser.SkipAnswer(); err != nil {
+			return
+		}
+	}
+}
+
+func (r *ttlRecorder) get() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Duration(r.min) * time.Second
+}
+
+// ttlConn passes DNS responses read by the resolver to a ttlRecorder. Over TCP messages are
+// prefixed with their length and may arrive in pieces, over UDP each read is one message.
+type ttlConn struct {
+	net.Conn
+	stream  bool
+	pending []byte
+	ttl     *ttlRecorder
+}
+
+func (c *ttlConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n == 0 {
+		return n, err
+	}
+	if !c.stream {
+		c.ttl.observe(b[:n])
+		return n, err
+	}
+	c.pending = append(c.pending, b[:n]...)
+	for len(c.pending) >= 2 {
+		length := int(binary.BigEndian.Uint16(c.pending))
+		if len(c.pending) < 2+length {
+			break
+		}
+		c.ttl.observe(c.pending[2 : 2+length])
+		c.pending = c.pending[2+length:]
+	}
+	return n, err
+}
+
+// srvCache caches SRV lookups for the TTL of their records and keeps using the previous records
+// while a refresh fails.
+type srvCache struct {
+	resolver srvResolver
+
+	mu      sync.Mutex
+	entries map[string]*srvEntry
+}
+
+type srvEntry struct {
+	mu      sync.Mutex
+	records []*net.SRV
+	expires time.Time
+}
+
+func newSRVCache(resolver srvResolver) *srvCache {
+	return &srvCache{resolver: resolver, entries: make(map[string]*srvEntry)}
+}
+
+// targets returns the addresses to try for name, in the order given by priority and weight.
+func (c *srvCache) targets(ctx context.Context, name string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	if !ok {
+		entry = &srvEntry{}
+		c.entries[name] = entry
+	}
+	c.mu.Unlock()
+
+	// Connections waiting for the same name share a single lookup
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if now := time.Now(); now.After(entry.expires) {
+		records, ttl, err := c.resolver.LookupSRV(ctx, name)
+		if err == nil && len(records) == 0 {
+			err = fmt.Errorf("no SRV records found for %s", name)
+		}
+		switch {
+		case err == nil:
+			entry.records = records
+			entry.expires = now.Add(max(ttl, srvMinTTL))
+		case entry.records == nil:
+			return nil, err
+		default:
+			// Keep serving the stale records for a while instead of waiting on every connection
+			// for a resolver that is down
+			logger.Warnf("Failed to refresh SRV records of %s, using the previous ones: %s", name, err)
+			entry.expires = now.Add(srvMinTTL)
+		}
+	}
+	return orderSRV(entry.records), nil
+}
+
+// orderSRV sorts records by priority and shuffles those of equal priority by weight as
+// described in RFC 2782. A target of "." means the service is not available there.
+func orderSRV(records []*net.SRV) []string {
+	sorted := slices.DeleteFunc(slices.Clone(records), func(r *net.SRV) bool { return r.Target == "." })
+	slices.SortStableFunc(sorted, func(a, b *net.SRV) int { return cmp.Compare(a.Priority, b.Priority) })
+
+	targets := make([]string, 0, len(sorted))
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+		for group := sorted[start:end]; len(group) > 0; {
+			pick := pickByWeight(group)
+			target := group[pick]
+			targets = append(targets, net.JoinHostPort(strings.TrimSuffix(target.Target, "."), strconv.Itoa(int(target.Port))))
+			group = slices.Delete(group, pick, pick+1)
+		}
+		start = end
+	}
+	return targets
+}
+
+// pickByWeight returns the index of a record chosen with a probability proportional to its weight,
+// records of weight zero are only chosen once no other is left.
+func pickByWeight(group []*net.SRV) int {
+	total := 0
+	for _, r := range group {
+		total += int(r.Weight)
+	}
+	if total == 0 {
+		return rand.IntN(len(group))
+	}
+	n := rand.IntN(total)
+	for i, r := range group {
+		n -= int(r.Weight)
+		if n < 0 {
+			return i
+		}
+	}
+	return len(group) - 1
+}
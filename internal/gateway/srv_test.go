@@ -0,0 +1,212 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+)
+
+// stubResolver answers SRV lookups with fixed records, or err once it is set.
+type stubResolver struct {
+	mu      sync.Mutex
+	records []*net.SRV
+	ttl     time.Duration
+	err     error
+	lookups int
+}
+
+func (r *stubResolver) LookupSRV(ctx context.Context, name string) ([]*net.SRV, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+	return r.records, r.ttl, nil
+}
+
+func (r *stubResolver) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+func (r *stubResolver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups
+}
+
+func srv(target string, port, priority, weight uint16) *net.SRV {
+	return &net.SRV{Target: target, Port: port, Priority: priority, Weight: weight}
+}
+
+// expire makes the cached records of name due for a refresh.
+func expire(c *srvCache, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[name].expires = time.Now().Add(-time.Second)
+}
+
+func TestOrderSRVPriority(t *testing.T) {
+	records := []*net.SRV{
+		srv("c.example.com.", 25565, 20, 0),
+		srv("a.example.com.", 25565, 0, 5),
+		srv(".", 25565, 5, 5),
+		srv("b.example.com.", 25566, 10, 5),
+	}
+	got := orderSRV(records)
+	want := []string{"a.example.com:25565", "b.example.com:25566", "c.example.com:25565"}
+	if len(got) != len(want) {
+		t.Fatalf("orderSRV() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("orderSRV() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestOrderSRVWeight(t *testing.T) {
+	records := []*net.SRV{
+		srv("zero.example.com.", 25565, 0, 0),
+		srv("light.example.com.", 25565, 0, 10),
+		srv("heavy.example.com.", 25565, 0, 90),
+	}
+	const runs = 2000
+	first := make(map[string]int)
+	for range runs {
+		order := orderSRV(records)
+		if len(order) != 3 {
+			t.Fatalf("orderSRV() = %v, want all three targets", order)
+		}
+		if order[2] != "zero.example.com:25565" {
+			t.Fatalf("orderSRV() = %v, weight zero target must come last", order)
+		}
+		first[order[0]]++
+	}
+	// Expected 90% first for the heavy target, allowing for chance
+	if share := float64(first["heavy.example.com:25565"]) / runs; share < 0.85 || share > 0.95 {
+		t.Fatalf("heavy target first in %.2f of runs, want about 0.9", share)
+	}
+}
+
+func TestSRVCacheTTL(t *testing.T) {
+	resolver := &stubResolver{records: []*net.SRV{srv("mc.example.com.", 25565, 0, 0)}, ttl: time.Minute}
+	cache := newSRVCache(resolver)
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := cache.targets(ctx, "mc.example.com"); err != nil {
+			t.Fatalf("targets() = %v", err)
+		}
+	}
+	if n := resolver.count(); n != 1 {
+		t.Fatalf("%d lookups within the TTL, want 1", n)
+	}
+
+	expire(cache, "mc.example.com")
+	if _, err := cache.targets(ctx, "mc.example.com"); err != nil {
+		t.Fatalf("targets() = %v", err)
+	}
+	if n := resolver.count(); n != 2 {
+		t.Fatalf("%d lookups after the TTL expired, want 2", n)
+	}
+}
+
+func TestSRVCacheStaleOnError(t *testing.T) {
+	resolver := &stubResolver{records: []*net.SRV{srv("mc.example.com.", 25565, 0, 0)}, ttl: time.Minute}
+	cache := newSRVCache(resolver)
+	ctx := context.Background()
+
+	if _, err := cache.targets(ctx, "mc.example.com"); err != nil {
+		t.Fatalf("targets() = %v", err)
+	}
+	resolver.fail(errors.New("resolver down"))
+	expire(cache, "mc.example.com")
+
+	for range 3 {
+		targets, err := cache.targets(ctx, "mc.example.com")
+		if err != nil {
+			t.Fatalf("targets() = %v, want the previous records", err)
+		}
+		if len(targets) != 1 || targets[0] != "mc.example.com:25565" {
+			t.Fatalf("targets() = %v, want the previous records", targets)
+		}
+	}
+	// Only the first connection after the expiry waits for the failing resolver
+	if n := resolver.count(); n != 2 {
+		t.Fatalf("%d lookups, want 2", n)
+	}
+
+	if _, err := newSRVCache(resolver).targets(ctx, "mc.example.com"); err == nil {
+		t.Fatal("targets() without previous records succeeded")
+	}
+}
+
+func TestDialSRVFailover(t *testing.T) {
+	closed := listen(t)
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	_ = closed.Close()
+
+	backend := listen(t)
+	go func() {
+		if conn, err := backend.Accept(); err == nil {
+			_ = conn.Close()
+		}
+	}()
+	backendPort := backend.Addr().(*net.TCPAddr).Port
+
+	g := NewGateway(newTestConfig(t, "127.0.0.1:1"))
+	g.srv = newSRVCache(&stubResolver{records: []*net.SRV{
+		srv("127.0.0.1.", uint16(backendPort), 10, 0),
+		srv("127.0.0.1.", uint16(closedPort), 0, 0),
+	}})
+
+	conn, err := g.dialBackend(context.Background(), &net.Dialer{}, config.SRVAddressPrefix+"mc.example.com")
+	if err != nil {
+		t.Fatalf("dialBackend() = %v", err)
+	}
+	defer conn.Close()
+	if got := conn.RemoteAddr().String(); got != net.JoinHostPort("127.0.0.1", strconv.Itoa(backendPort)) {
+		t.Fatalf("connected to %s, want the second target", got)
+	}
+}
+
+func TestDialSRVFailoverAfterTimeout(t *testing.T) {
+	blackhole := blackholeAddr(t)
+	_, blackholePort, _ := net.SplitHostPort(blackhole)
+	port, _ := strconv.Atoi(blackholePort)
+
+	backend := listen(t)
+	go func() {
+		if conn, err := backend.Accept(); err == nil {
+			_ = conn.Close()
+		}
+	}()
+	backendPort := backend.Addr().(*net.TCPAddr).Port
+
+	conf := newTestConfig(t, "127.0.0.1:1")
+	conf.Timeout = time.Second
+	g := NewGateway(conf)
+	g.srv = newSRVCache(&stubResolver{records: []*net.SRV{
+		srv("127.0.0.1.", uint16(port), 0, 0),
+		srv("127.0.0.1.", uint16(backendPort), 10, 0),
+	}})
+
+	// The first target never completes the TCP handshake and must not use up the whole timeout
+	conn, err := g.dialWithRetry(context.Background(), conf, config.SRVAddressPrefix+"mc.example.com")
+	if err != nil {
+		t.Fatalf("dialWithRetry() = %v", err)
+	}
+	defer conn.Close()
+	if got := conn.RemoteAddr().(*net.TCPAddr).Port; got != backendPort {
+		t.Fatalf("connected to port %d, want the second target %d", got, backendPort)
+	}
+}
@@ -0,0 +1,172 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+// maxStatusSample is the number of players the vanilla client lists in the hover text of the player count
+const maxStatusSample = 12
+
+// serveAggregateStatus answers a status ping of a server with status_aggregate set, adding up the
+// players of all its backends that answer. It returns false without touching the client when none
+// does, the ping is then proxied as usual.
+func (g *Gateway) serveAggregateStatus(sess *session, clientConn net.Conn, reader *bufio.Reader, conf *config.Config, serverName string, data []byte) bool {
+	aggregate, backends := conf.GetStatusAggregate(serverName)
+
+	span := sess.startSpan("status_aggregate.query")
+	targets := g.aggregateTargets(sess.ctx, backends)
+	statuses := make([]*protocol.StatusResponse, len(targets))
+	bodies := make([][]byte, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, err := g.backendStatus(sess.ctx, conf, serverName, target, int32(sess.handshake.ProtocolVersion), data)
+			if err == nil {
+				var status protocol.StatusResponse
+				if err = json.Unmarshal(body, &status); err == nil {
+					statuses[i], bodies[i] = &status, body
+				}
+			}
+			if err != nil {
+				logger.Debugf("Leaving backend %s out of the status of server %s: %s", target, serverName, err)
+			}
+		}()
+	}
+	wg.Wait()
+	span.End()
+
+	status := mergeStatuses(statuses)
+	if status == nil {
+		logger.Debugf("No backend of server %s answered, forwarding the ping of %s", serverName, sess.clientAddr)
+		return false
+	}
+	if aggregate.MOTD != "" {
+		status.Description = protocol.TextComponent(aggregate.MOTD)
+	}
+	if favicon := aggregate.FaviconURI(); favicon != "" {
+		status.Favicon = favicon
+	}
+	if conf.StatusCache.RewriteProtocol {
+		status.Version.Protocol = int32(sess.handshake.ProtocolVersion)
+	}
+
+	var answered []string
+	var base []byte
+	for i, target := range targets {
+		if statuses[i] != nil {
+			answered = append(answered, target)
+			if base == nil {
+				base = bodies[i]
+			}
+		}
+	}
+	body, err := mergeStatusJSON(base, status)
+	if err != nil {
+		logger.Debugf("Failed to encode aggregated status of server %s: %s", serverName, err)
+		sess.close(closeError, err)
+		return true
+	}
+	sess.routed()
+	sess.backend = strings.Join(answered, ",")
+	err = protocol.ServeStatusJSON(reader, clientConn, body)
+	if err != nil {
+		logger.Debugf("Failed to send aggregated status to %s: %s", sess.clientAddr, err)
+	}
+	sess.close(closeStatusAggregated, err)
+	return true
+}
+
+// aggregateTargets expands srv:// backends into the addresses of all their targets, sorted so the
+// first backend to answer does not change between pings.
+func (g *Gateway) aggregateTargets(ctx context.Context, backends []string) []string {
+	var targets []string
+	for _, backend := range backends {
+		name, ok := strings.CutPrefix(backend, config.SRVAddressPrefix)
+		if !ok {
+			targets = append(targets, backend)
+			continue
+		}
+		addrs, err := g.srv.targets(ctx, name)
+		if err != nil {
+			logger.Debugf("Failed to look up SRV records of %s for an aggregated status: %s", name, err)
+			continue
+		}
+		slices.Sort(addrs)
+		targets = append(targets, addrs...)
+	}
+	seen := make(map[string]bool, len(targets))
+	return slices.DeleteFunc(targets, func(target string) bool {
+		if seen[target] {
+			return true
+		}
+		seen[target] = true
+		return false
+	})
+}
+
+// mergeStatuses adds up the players of the given statuses and merges their samples, version,
+// description and favicon come from the first one. Nil statuses are skipped, nil is returned
+// when there are no others.
+func mergeStatuses(statuses []*protocol.StatusResponse) *protocol.StatusResponse {
+	var merged *protocol.StatusResponse
+	seen := make(map[string]bool)
+	for _, status := range statuses {
+		if status == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &protocol.StatusResponse{
+				Version:     status.Version,
+				Players:     &protocol.StatusPlayers{},
+				Description: status.Description,
+				Favicon:     status.Favicon,
+			}
+		}
+		if status.Players == nil {
+			continue
+		}
+		merged.Players.Max += status.Players.Max
+		merged.Players.Online += status.Players.Online
+		for _, player := range status.Players.Sample {
+			if len(merged.Players.Sample) == maxStatusSample {
+				break
+			}
+			if !seen[player.ID] {
+				seen[player.ID] = true
+				merged.Players.Sample = append(merged.Players.Sample, player)
+			}
+		}
+	}
+	return merged
+}
+
+// mergeStatusJSON encodes status over the response base of the first backend that answered,
+// keeping the fields of base that StatusResponse leaves out, such as forgeData or enforcesSecureChat.
+func mergeStatusJSON(base []byte, status *protocol.StatusResponse) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(base, &fields); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	var known map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &known); err != nil {
+		return nil, err
+	}
+	maps.Copy(fields, known)
+	return json.Marshal(fields)
+}
@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+func TestMergeStatusJSONKeepsUnknownFields(t *testing.T) {
+	base := []byte(`{"version":{"name":"1.20.4","protocol":765},"players":{"max":20,"online":1},` +
+		`"description":"lobby","favicon":"data:image/png;base64,AA==","enforcesSecureChat":true,` +
+		`"forgeData":{"fmlNetworkVersion":3}}`)
+	status := &protocol.StatusResponse{
+		Version:     protocol.StatusVersion{Name: "1.20.4", Protocol: 765},
+		Players:     &protocol.StatusPlayers{Max: 40, Online: 3},
+		Description: json.RawMessage(`"network"`),
+		Favicon:     "data:image/png;base64,AA==",
+	}
+
+	body, err := mergeStatusJSON(base, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(body, &merged); err != nil {
+		t.Fatal(err)
+	}
+	for field, want := range map[string]string{
+		"enforcesSecureChat": `true`,
+		"forgeData":          `{"fmlNetworkVersion":3}`,
+		"description":        `"network"`,
+		"players":            `{"max":40,"online":3}`,
+		"favicon":            `"data:image/png;base64,AA=="`,
+	} {
+		if got := string(merged[field]); got != want {
+			t.Errorf("%s = %s, want %s", field, got, want)
+		}
+	}
+}
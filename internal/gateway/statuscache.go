@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+const (
+	// statusQueryTimeout bounds a status query once the backend is connected
+	statusQueryTimeout = 5 * time.Second
+	// statusIdleRefreshes is the number of background refreshes a status nobody asked for is kept
+	statusIdleRefreshes = 10
+)
+
+// statusKey identifies a cached status. Backends may answer differently per server name, but
+// hostnames of unknown servers are up to the client and share the entry of their backend.
+// Statuses are kept per protocol version unless the gateway rewrites it for each client.
+type statusKey struct {
+	backend  string
+	server   string
+	protocol int32
+}
+
+// statusFetcher queries the status of the backend of key with the given forwarded handshake.
+type statusFetcher func(ctx context.Context, key statusKey, handshake []byte) ([]byte, error)
+
+type statusEntry struct {
+	mu        sync.Mutex
+	body      []byte
+	err       error
+	fetchedAt time.Time
+	usedAt    time.Time
+	// handshake of the latest ping, repeated by background refreshes
+	handshake []byte
+}
+
+// statusCache holds the latest status response of each backend.
+type statusCache struct {
+	mu      sync.Mutex
+	entries map[statusKey]*statusEntry
+
+	startRefresh sync.Once
+}
+
+// get returns the cached status for key, fetching it when the cache is older than maxAge.
+// Pings waiting for the same entry share a single query. A failed query is remembered in place
+// of the status, so later pings neither see a backend that went away as online nor wait for
+// another dial to it until maxAge has passed.
+func (c *statusCache) get(ctx context.Context, key statusKey, handshake []byte, maxAge time.Duration, fetch statusFetcher) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		if c.entries == nil {
+			c.entries = make(map[statusKey]*statusEntry)
+		}
+		entry = &statusEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	now := time.Now()
+	entry.usedAt = now
+	entry.handshake = handshake
+	if (entry.body != nil || entry.err != nil) && now.Sub(entry.fetchedAt) < maxAge {
+		return entry.body, entry.err
+	}
+	entry.body, entry.err = fetch(ctx, key, handshake)
+	entry.fetchedAt = now
+	return entry.body, entry.err
+}
+
+// refresh queries the status of all entries in parallel and drops those unused for longer than idle.
+func (c *statusCache) refresh(ctx context.Context, idle time.Duration, fetch statusFetcher) {
+	now := time.Now()
+	var wg sync.WaitGroup
+	c.mu.Lock()
+	for key, entry := range c.entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry.mu.Lock()
+			defer entry.mu.Unlock()
+			if now.Sub(entry.usedAt) > idle {
+				c.mu.Lock()
+				delete(c.entries, key)
+				c.mu.Unlock()
+				return
+			}
+			entry.body, entry.err = fetch(ctx, key, entry.handshake)
+			entry.fetchedAt = time.Now()
+			if entry.err != nil {
+				logger.Debugf("Failed to refresh status of backend %s: %s", key.backend, entry.err)
+			}
+		}()
+	}
+	c.mu.Unlock()
+	wg.Wait()
+}
+
+// refreshStatuses refreshes the status cache every TTL while background refreshes are enabled,
+// until the gateway shuts down. Each refresh queries with the config current at that time.
+func (g *Gateway) refreshStatuses() {
+	for {
+		g.configMutex.RLock()
+		ttl := g.config.StatusCache.TTL
+		g.configMutex.RUnlock()
+
+		timer := time.NewTimer(ttl)
+		select {
+		case <-g.done.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		g.configMutex.RLock()
+		conf := g.config
+		g.configMutex.RUnlock()
+		if conf.StatusCache.Enabled && conf.StatusCache.Background {
+			g.statuses.refresh(g.done, statusIdleRefreshes*conf.StatusCache.TTL, func(ctx context.Context, key statusKey, handshake []byte) ([]byte, error) {
+				return g.queryStatus(ctx, conf, key.server, key.backend, handshake)
+			})
+		}
+	}
+}
+
+// serveCachedStatus answers a status ping from the status cache of the backend. A backend that
+// could not be queried is answered for as unavailable, the way a failed dial of the proxy is, so
+// pings do not dial it again until the failure expires. It returns false without touching the
+// client when fallbacks could answer instead, the ping is then proxied as usual.
+func (g *Gateway) serveCachedStatus(sess *session, clientConn net.Conn, reader *bufio.Reader, backendAddr string, conf *config.Config, serverName string, data []byte) bool {
+	span := sess.startSpan("status_cache.get", attrBackend.String(backendAddr))
+	body, err := g.backendStatus(sess.ctx, conf, serverName, backendAddr, int32(sess.handshake.ProtocolVersion), data)
+	endSpan(span, err)
+	if err != nil {
+		if len(g.backendTargets(conf, serverName, backendAddr, sess.handshake)) > 1 {
+			logger.Debugf("Failed to get status of backend %s, forwarding the ping of %s to the fallbacks: %s", backendAddr, sess.clientAddr, err)
+			return false
+		}
+		logger.Debugf("Failed to get status of backend %s, answering the ping of %s as unavailable: %s", backendAddr, sess.clientAddr, err)
+		sess.routed()
+		sess.backend = backendAddr
+		sess.close(closeBackendUnavailable, err)
+		if err := kickConnection(clientConn, reader, sess.handshake, "Unavailable", conf.CircuitBreaker.Message); err != nil {
+			logger.Debugf("Failed to send unavailable message to %s: %s", sess.clientAddr, err)
+		}
+		return true
+	}
+	if conf.StatusCache.RewriteProtocol {
+		rewritten, err := protocol.RewriteStatusProtocol(body, int32(sess.handshake.ProtocolVersion))
+		if err != nil {
+			logger.Debugf("Failed to rewrite protocol version in status of backend %s: %s", backendAddr, err)
+		} else {
+			body = rewritten
+		}
+	}
+
+	sess.routed()
+	sess.backend = backendAddr
+	err = protocol.ServeStatusJSON(reader, clientConn, body)
+	if err != nil {
+		logger.Debugf("Failed to send cached status to %s: %s", sess.clientAddr, err)
+	}
+	sess.close(closeStatusCached, err)
+	return true
+}
+
+// backendStatus returns the status of a backend for a client of protocolVersion with the given
+// forwarded handshake, taken from the status cache when it is enabled.
+func (g *Gateway) backendStatus(ctx context.Context, conf *config.Config, serverName, backendAddr string, protocolVersion int32, data []byte) ([]byte, error) {
+	cache := conf.StatusCache
+	if !cache.Enabled {
+		return g.queryStatus(ctx, conf, serverName, backendAddr, data)
+	}
+	key := statusKey{backend: backendAddr}
+	if conf.HasServer(serverName) {
+		key.server = serverName
+	}
+	if !cache.RewriteProtocol {
+		key.protocol = protocolVersion
+	}
+	maxAge := cache.TTL
+	if cache.Background {
+		// The refresher keeps the entry current, a late tick should not make pings wait for a query
+		g.statuses.startRefresh.Do(func() { go g.refreshStatuses() })
+		maxAge *= 2
+	}
+	return g.statuses.get(ctx, key, data, maxAge, func(ctx context.Context, key statusKey, handshake []byte) ([]byte, error) {
+		return g.queryStatus(ctx, conf, serverName, backendAddr, handshake)
+	})
+}
+
+// queryStatus connects to the backend and asks for its status with the given handshake.
+func (g *Gateway) queryStatus(ctx context.Context, conf *config.Config, serverName, backendAddr string, handshake []byte) ([]byte, error) {
+	conn, err := g.dialWithRetry(ctx, conf, backendAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if err := conn.SetDeadline(time.Now().Add(statusQueryTimeout)); err != nil {
+		return nil, err
+	}
+
+	// The query comes from the gateway itself, not from any client
+	if conf.GetProxyProtocol(serverName).SendToUpstream {
+		header, err := protocol.BuildProxyProtocolV1Header(conn.LocalAddr(), conn.RemoteAddr())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(header); err != nil {
+			return nil, err
+		}
+	}
+	return protocol.QueryStatus(conn, handshake)
+}
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+func TestStatusCacheRemembersFailure(t *testing.T) {
+	var cache statusCache
+	key := statusKey{backend: "127.0.0.1:25565"}
+	errDown := errors.New("backend down")
+	queries := 0
+	fetch := func(ctx context.Context, key statusKey, handshake []byte) ([]byte, error) {
+		queries++
+		return nil, errDown
+	}
+
+	for range 3 {
+		if _, err := cache.get(context.Background(), key, nil, time.Minute, fetch); !errors.Is(err, errDown) {
+			t.Fatalf("get() = %v, want %v", err, errDown)
+		}
+	}
+	if queries != 1 {
+		t.Fatalf("%d queries within maxAge, want 1", queries)
+	}
+
+	if _, err := cache.get(context.Background(), key, nil, 0, fetch); !errors.Is(err, errDown) {
+		t.Fatalf("get() = %v, want %v", err, errDown)
+	}
+	if queries != 2 {
+		t.Fatalf("%d queries after maxAge, want 2", queries)
+	}
+}
+
+func TestStatusCacheRefresh(t *testing.T) {
+	var cache statusCache
+	key := statusKey{backend: "127.0.0.1:25565", server: "mc.example.com"}
+	handshake := statusHandshake("mc.example.com")
+	_, err := cache.get(context.Background(), key, handshake, time.Minute, func(ctx context.Context, key statusKey, handshake []byte) ([]byte, error) {
+		return []byte(`{"description":"old"}`), nil
+	})
+	if err != nil {
+		t.Fatalf("get() = %v", err)
+	}
+
+	cache.refresh(context.Background(), time.Minute, func(ctx context.Context, got statusKey, gotHandshake []byte) ([]byte, error) {
+		if got != key || !bytes.Equal(gotHandshake, handshake) {
+			t.Errorf("refresh queried %v with %q, want %v with the handshake of the latest ping", got, gotHandshake, key)
+		}
+		return []byte(`{"description":"new"}`), nil
+	})
+	body, err := cache.get(context.Background(), key, handshake, time.Minute, nil)
+	if err != nil || string(body) != `{"description":"new"}` {
+		t.Fatalf("get() after refresh = %s, %v", body, err)
+	}
+
+	// Entries nobody asked for are dropped instead of refreshed
+	cache.refresh(context.Background(), 0, func(ctx context.Context, key statusKey, handshake []byte) ([]byte, error) {
+		t.Error("refresh queried an idle entry")
+		return nil, nil
+	})
+	if len(cache.entries) != 0 {
+		t.Fatalf("%d entries after an idle refresh, want 0", len(cache.entries))
+	}
+}
+
+func TestStatusCacheKeyedByProtocol(t *testing.T) {
+	l := listen(t)
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	for _, rewrite := range []bool{false, true} {
+		conf := newTestConfig(t, addr)
+		conf.StatusCache.Enabled = true
+		conf.StatusCache.TTL = time.Minute
+		conf.StatusCache.RewriteProtocol = rewrite
+		g := NewGateway(conf)
+		for _, version := range []int32{47, 767} {
+			_, _ = g.backendStatus(context.Background(), conf, "", addr, version, statusHandshake("mc.example.com"))
+		}
+		want := 2
+		if rewrite {
+			want = 1
+		}
+		if n := len(g.statuses.entries); n != want {
+			t.Fatalf("%d cache entries for two protocol versions with rewrite_protocol %t, want %d", n, rewrite, want)
+		}
+	}
+}
+
+func TestStatusCacheServesFailure(t *testing.T) {
+	// The backend hangs up on every connection, status queries to it fail
+	backend := listen(t)
+	var accepts atomic.Int32
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			accepts.Add(1)
+			_ = conn.Close()
+		}
+	}()
+
+	conf := newTestConfig(t, backend.Addr().String())
+	conf.StatusCache.Enabled = true
+	conf.StatusCache.TTL = time.Minute
+	g := startGateway(t, conf)
+
+	for range 3 {
+		conn := g.dial(t)
+		if _, err := conn.Write(append(statusHandshake("mc.example.com"), 0x01, 0x00)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		id, payload, err := protocol.ReadPacket(bufio.NewReader(conn), 1<<16)
+		if err != nil || id != 0x00 || !bytes.Contains(payload, []byte(conf.CircuitBreaker.Message)) {
+			t.Fatalf("status response = 0x%02x %q, %v, want the unavailable message", id, payload, err)
+		}
+		_ = conn.Close()
+		if info := g.closedSession(t); info.CloseReason != string(closeBackendUnavailable) {
+			t.Fatalf("close reason = %q, want %q", info.CloseReason, closeBackendUnavailable)
+		}
+	}
+	if n := accepts.Load(); n != 1 {
+		t.Fatalf("backend dialed %d times, want once for the cached failure", n)
+	}
+}
@@ -0,0 +1,38 @@
+package gateway
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/SmallL-U/minecraft-gateway/gateway"
+
+// Span attribute keys shared by the session span and its children
+const (
+	attrSessionID       = attribute.Key("session.id")
+	attrClientAddress   = attribute.Key("client.address")
+	attrServerName      = attribute.Key("minecraft.server_name")
+	attrProtocolVersion = attribute.Key("minecraft.protocol_version")
+	attrNextState       = attribute.Key("minecraft.next_state")
+	attrUsername        = attribute.Key("minecraft.username")
+	attrBackend         = attribute.Key("backend.address")
+	attrBytesUp         = attribute.Key("session.bytes_up")
+	attrBytesDown       = attribute.Key("session.bytes_down")
+	attrCloseReason     = attribute.Key("session.close_reason")
+)
+
+// startSpan starts a child span of the session span.
+func (s *session) startSpan(name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := s.span.TracerProvider().Tracer(tracerName).Start(s.ctx, name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// endSpan ends the span, marking it failed if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,69 @@
+package logx
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// swapCore forwards to a core that can be replaced at runtime, so loggers handed out
+// at startup follow configuration reloads.
+type swapCore struct {
+	current *atomic.Pointer[zapcore.Core]
+	// Held for reading by each write, so drain can wait for writes to a replaced core
+	writes *sync.RWMutex
+	fields []zapcore.Field
+}
+
+func newSwapCore(core zapcore.Core) *swapCore {
+	current := &atomic.Pointer[zapcore.Core]{}
+	current.Store(&core)
+	return &swapCore{current: current, writes: &sync.RWMutex{}}
+}
+
+func (c *swapCore) swap(core zapcore.Core) {
+	c.current.Store(&core)
+}
+
+// drain waits for writes that started before the last swap, the replaced core is unused afterwards.
+func (c *swapCore) drain() {
+	c.writes.Lock()
+	defer c.writes.Unlock()
+}
+
+func (c *swapCore) load() zapcore.Core {
+	core := *c.current.Load()
+	if len(c.fields) > 0 {
+		core = core.With(c.fields)
+	}
+	return core
+}
+
+func (c *swapCore) Enabled(level zapcore.Level) bool {
+	return (*c.current.Load()).Enabled(level)
+}
+
+func (c *swapCore) With(fields []zapcore.Field) zapcore.Core {
+	merged := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	merged = append(merged, c.fields...)
+	merged = append(merged, fields...)
+	return &swapCore{current: c.current, writes: c.writes, fields: merged}
+}
+
+func (c *swapCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *swapCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	return c.load().Write(entry, fields)
+}
+
+func (c *swapCore) Sync() error {
+	return (*c.current.Load()).Sync()
+}
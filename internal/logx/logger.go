@@ -3,24 +3,60 @@ package logx
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-const defaultLogLevel = "info"
+const (
+	defaultLogLevel = "info"
 
-var (
-	atomicLevel = zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	logger      *zap.SugaredLogger
+	FormatConsole = "console"
+	FormatJSON    = "json"
+
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
 )
 
-func init() {
-	logger = newConsoleLogger(atomicLevel)
+// Options describes where and how log records are written.
+type Options struct {
+	Level       string
+	AccessLevel string
+	Format      string
+	// Output is stdout, stderr or a file path.
+	Output   string
+	Rotation RotationOptions
+	Access   AccessOptions
+	Sampling SamplingOptions
+}
+
+// AccessOptions gives the access log its own sink. Empty values fall back to the main log settings.
+type AccessOptions struct {
+	Format   string
+	Output   string
+	Rotation RotationOptions
 }
 
-func newConsoleLogger(level zap.AtomicLevel) *zap.SugaredLogger {
+var (
+	atomicLevel       = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	accessAtomicLevel = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+
+	mainCore   = newSwapCore(newCore(FormatConsole, zapcore.AddSync(os.Stdout), true, atomicLevel))
+	accessCore = newSwapCore(newCore(FormatConsole, zapcore.AddSync(os.Stdout), true, accessAtomicLevel))
+
+	logger       = zap.New(mainCore).Sugar()
+	accessLogger = zap.New(accessCore).Named("access")
+
+	// Files currently written by the loggers, closed once a configuration no longer uses them.
+	// Held while a configuration is prepared and applied, so files are not reused and closed at once
+	outputMu sync.Mutex
+	outputs  []*rotatingFile
+)
+
+func newCore(format string, ws zapcore.WriteSyncer, terminal bool, level zap.AtomicLevel) zapcore.Core {
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:        "time",
 		LevelKey:       "level",
@@ -29,19 +65,172 @@ func newConsoleLogger(level zap.AtomicLevel) *zap.SugaredLogger {
 		MessageKey:     "msg",
 		StacktraceKey:  "stacktrace",
 		LineEnding:     zapcore.DefaultLineEnding,
-		EncodeLevel:    zapcore.CapitalColorLevelEncoder,
+		EncodeLevel:    zapcore.CapitalLevelEncoder,
 		EncodeTime:     zapcore.TimeEncoderOfLayout("2006-01-02 15:04:05"),
 		EncodeDuration: zapcore.StringDurationEncoder,
 		EncodeCaller:   zapcore.ShortCallerEncoder,
 	}
 
-	core := zapcore.NewCore(
-		zapcore.NewConsoleEncoder(encoderConfig),
-		zapcore.AddSync(os.Stdout),
-		level,
-	)
+	var encoder zapcore.Encoder
+	if format == FormatJSON {
+		encoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+		encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+		encoderConfig.EncodeDuration = zapcore.MillisDurationEncoder
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	} else {
+		// Colors only make sense on a terminal
+		if terminal {
+			encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		}
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	}
 
-	return zap.New(core).Sugar()
+	return zapcore.NewCore(encoder, ws, level)
+}
+
+// openOutput returns the writer for the given output and whether it is a terminal stream. A file
+// the loggers already write with the same rotation is reused, so reloads do not reopen it.
+func openOutput(output string, rotation RotationOptions) (zapcore.WriteSyncer, *rotatingFile, bool, error) {
+	switch output {
+	case "", OutputStdout:
+		return zapcore.AddSync(os.Stdout), nil, true, nil
+	case OutputStderr:
+		return zapcore.AddSync(os.Stderr), nil, true, nil
+	}
+	for _, file := range outputs {
+		if file.path == output && file.opts == rotation {
+			return file, file, false, nil
+		}
+	}
+	file, err := newRotatingFile(output, rotation)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return file, file, false, nil
+}
+
+// Prepared is a validated logging configuration whose outputs are open. It takes effect with
+// Apply, or is dropped with Discard. Until then no other configuration can be prepared.
+type Prepared struct {
+	level, accessLevel zapcore.Level
+	core, accessCore   zapcore.Core
+	files              []*rotatingFile
+	sampling           SamplingOptions
+	done               bool
+}
+
+// Prepare validates the given options and opens their outputs without changing the loggers.
+func Prepare(opts Options) (*Prepared, error) {
+	level, err := parseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	accessLevel, err := parseLevel(opts.AccessLevel)
+	if err != nil {
+		return nil, fmt.Errorf("access log: %w", err)
+	}
+	format, err := parseFormat(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	accessFormat := format
+	if opts.Access.Format != "" {
+		if accessFormat, err = parseFormat(opts.Access.Format); err != nil {
+			return nil, fmt.Errorf("access log: %w", err)
+		}
+	}
+
+	outputMu.Lock()
+	p := &Prepared{level: level, accessLevel: accessLevel, sampling: opts.Sampling}
+	ws, file, terminal, err := openOutput(opts.Output, opts.Rotation)
+	if err != nil {
+		outputMu.Unlock()
+		return nil, fmt.Errorf("failed to open log output %q: %w", opts.Output, err)
+	}
+	if file != nil {
+		p.files = append(p.files, file)
+	}
+	// The access log shares the main writer unless it has a destination of its own
+	accessWS, accessTerminal := ws, terminal
+	if opts.Access.Output != "" && opts.Access.Output != opts.Output {
+		accessWS, file, accessTerminal, err = openOutput(opts.Access.Output, opts.Access.Rotation)
+		if err != nil {
+			p.Discard()
+			return nil, fmt.Errorf("failed to open access log output %q: %w", opts.Access.Output, err)
+		}
+		if file != nil {
+			p.files = append(p.files, file)
+		}
+	}
+	p.core = newCore(format, ws, terminal, atomicLevel)
+	p.accessCore = newCore(accessFormat, accessWS, accessTerminal, accessAtomicLevel)
+	return p, nil
+}
+
+// Apply makes the loggers use the prepared configuration. Files no longer used are closed once
+// records being written to them are done.
+func (p *Prepared) Apply() {
+	if p.done {
+		return
+	}
+	p.done = true
+	defer outputMu.Unlock()
+
+	atomicLevel.SetLevel(p.level)
+	accessAtomicLevel.SetLevel(p.accessLevel)
+	_ = mainCore.Sync()
+	_ = accessCore.Sync()
+	mainCore.swap(p.core)
+	accessCore.swap(p.accessCore)
+	mainCore.drain()
+	accessCore.drain()
+
+	configureSamplers(p.sampling)
+
+	for _, file := range outputs {
+		if !slices.Contains(p.files, file) {
+			_ = file.Close()
+		}
+	}
+	outputs = p.files
+}
+
+// Discard closes the files opened for the prepared configuration that the loggers do not use.
+func (p *Prepared) Discard() {
+	if p.done {
+		return
+	}
+	p.done = true
+	defer outputMu.Unlock()
+
+	for _, file := range p.files {
+		if !slices.Contains(outputs, file) {
+			_ = file.Close()
+		}
+	}
+}
+
+// Configure applies the given options to the logger and the access logger. Loggers obtained
+// earlier keep working and pick up the new settings.
+func Configure(opts Options) error {
+	p, err := Prepare(opts)
+	if err != nil {
+		return err
+	}
+	p.Apply()
+	return nil
+}
+
+func parseFormat(format string) (string, error) {
+	normalizedFormat := strings.TrimSpace(strings.ToLower(format))
+	switch normalizedFormat {
+	case "", FormatConsole:
+		return FormatConsole, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("invalid log format %q", format)
+	}
 }
 
 func SetLevel(level string) error {
@@ -79,3 +268,8 @@ func parseLevel(level string) (zapcore.Level, error) {
 func GetLogger() *zap.SugaredLogger {
 	return logger
 }
+
+// GetAccessLogger returns the structured logger used for per-session access records.
+func GetAccessLogger() *zap.Logger {
+	return accessLogger
+}
@@ -0,0 +1,135 @@
+package logx
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultSamplingLimit    = 10
+	defaultSamplingInterval = time.Minute
+
+	// Distinct sources tracked per interval, further sources are only counted
+	maxSampledSources = 100000
+)
+
+// SamplingOptions controls how many events of each kind are logged per interval.
+type SamplingOptions struct {
+	// Limit is the number of events logged per interval, a negative value disables sampling.
+	Limit    int
+	Interval time.Duration
+}
+
+var (
+	samplersMu       sync.Mutex
+	samplers         []*Sampler
+	samplingSettings SamplingOptions
+)
+
+// Sampler rate limits a noisy kind of log event. The first events of each interval are
+// logged, the rest are counted and reported in a single summary when the interval ends.
+// A sampler runs no goroutine of its own, a timer for the summary is only started once an
+// event is suppressed.
+type Sampler struct {
+	name string
+
+	mu         sync.Mutex
+	limit      int
+	interval   time.Duration
+	start      time.Time
+	logged     int
+	suppressed int
+	sources    map[string]struct{}
+	// Reports the suppressed events at the end of the interval, nil while there are none
+	summary *time.Timer
+}
+
+// NewSampler creates a sampler for events described by name, such as "handshake errors".
+// Its limits follow the sampling options passed to Configure.
+func NewSampler(name string) *Sampler {
+	s := &Sampler{
+		name:     name,
+		limit:    defaultSamplingLimit,
+		interval: defaultSamplingInterval,
+		sources:  make(map[string]struct{}),
+	}
+
+	samplersMu.Lock()
+	samplers = append(samplers, s)
+	s.configure(samplingSettings)
+	samplersMu.Unlock()
+	return s
+}
+
+// Allow reports whether an event from the given source should be logged. Events that are
+// not allowed are included in the next summary.
+func (s *Sampler) Allow(source string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Without suppressed events an interval ends quietly with the next event after it
+	now := time.Now()
+	if s.summary == nil && now.Sub(s.start) >= s.interval {
+		s.start, s.logged = now, 0
+	}
+	if s.limit < 0 || s.logged < s.limit {
+		s.logged++
+		return true
+	}
+	s.suppressed++
+	if len(s.sources) < maxSampledSources {
+		s.sources[source] = struct{}{}
+	}
+	if s.summary == nil {
+		s.summary = time.AfterFunc(s.start.Add(s.interval).Sub(now), s.flush)
+	}
+	return false
+}
+
+func (s *Sampler) configure(opts SamplingOptions) {
+	limit, interval := opts.Limit, opts.Interval
+	if limit == 0 {
+		limit = defaultSamplingLimit
+	}
+	if interval <= 0 {
+		interval = defaultSamplingInterval
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	if s.interval == interval {
+		return
+	}
+	s.interval = interval
+	// A pending summary moves to the end of the interval as it is now, one already due goes out as it is
+	if s.summary != nil && s.summary.Stop() {
+		s.summary = time.AfterFunc(time.Until(s.start.Add(interval)), s.flush)
+	}
+}
+
+// flush logs the summary of the interval that just ended and starts a new one.
+func (s *Sampler) flush() {
+	s.mu.Lock()
+	suppressed, sources, interval := s.suppressed, len(s.sources), s.interval
+	s.start = time.Now()
+	s.summary = nil
+	s.logged = 0
+	s.suppressed = 0
+	if sources > 0 {
+		s.sources = make(map[string]struct{})
+	}
+	s.mu.Unlock()
+
+	if suppressed > 0 {
+		logger.Infof("Suppressed %d %s from %d IPs in the last %s", suppressed, s.name, sources, interval)
+	}
+}
+
+func configureSamplers(opts SamplingOptions) {
+	samplersMu.Lock()
+	defer samplersMu.Unlock()
+	samplingSettings = opts
+	for _, s := range samplers {
+		s.configure(opts)
+	}
+}
@@ -30,6 +30,11 @@ func SendReload() error {
 	return sendSignal(syscall.SIGHUP)
 }
 
+// SendMaintenance tells the running instance to reread the maintenance state.
+func SendMaintenance() error {
+	return sendSignal(syscall.SIGUSR1)
+}
+
 // SendStop sends stop signal to the running instance.
 func SendStop() error {
 	return sendSignal(syscall.SIGTERM)
@@ -11,17 +11,19 @@ import (
 )
 
 const (
-	eventPrefix    = "Global\\minecraft-gateway"
-	eventStop      = eventPrefix + "_stop"
-	eventReload    = eventPrefix + "_reload"
-	mutexName      = eventPrefix + "_mutex"
+	eventPrefix      = "Global\\minecraft-gateway"
+	eventStop        = eventPrefix + "_stop"
+	eventReload      = eventPrefix + "_reload"
+	eventMaintenance = eventPrefix + "_maintenance"
+	mutexName        = eventPrefix + "_mutex"
 )
 
 var (
-	mutex        windows.Handle
-	stopEvent    windows.Handle
-	reloadEvent  windows.Handle
-	eventsMu     sync.Mutex
+	mutex            windows.Handle
+	stopEvent        windows.Handle
+	reloadEvent      windows.Handle
+	maintenanceEvent windows.Handle
+	eventsMu         sync.Mutex
 )
 
 // Acquire tries to acquire the process lock using a named mutex.
@@ -69,6 +71,10 @@ func Release() {
 		windows.CloseHandle(reloadEvent)
 		reloadEvent = 0
 	}
+	if maintenanceEvent != 0 {
+		windows.CloseHandle(maintenanceEvent)
+		maintenanceEvent = 0
+	}
 	if mutex != 0 {
 		windows.ReleaseMutex(mutex)
 		windows.CloseHandle(mutex)
@@ -81,23 +87,29 @@ func SendReload() error {
 	return setEvent(eventReload)
 }
 
+// SendMaintenance tells the running instance to reread the maintenance state.
+func SendMaintenance() error {
+	return setEvent(eventMaintenance)
+}
+
 // SendStop sends stop signal to the running instance.
 func SendStop() error {
 	return setEvent(eventStop)
 }
 
-// WaitForSignals waits for stop or reload events. Returns "stop", "reload", or error.
+// WaitForSignals waits for stop, reload or maintenance events. Returns "stop", "reload", "maintenance", or error.
 func WaitForSignals() (string, error) {
 	eventsMu.Lock()
 	stop := stopEvent
 	reload := reloadEvent
+	maintenance := maintenanceEvent
 	eventsMu.Unlock()
 
-	if stop == 0 || reload == 0 {
+	if stop == 0 || reload == 0 || maintenance == 0 {
 		return "", fmt.Errorf("events not initialized")
 	}
 
-	handles := []windows.Handle{stop, reload}
+	handles := []windows.Handle{stop, reload, maintenance}
 	event, err := windows.WaitForMultipleObjects(handles, false, windows.INFINITE)
 	if err != nil {
 		return "", fmt.Errorf("failed to wait for events: %v", err)
@@ -110,6 +122,9 @@ func WaitForSignals() (string, error) {
 		// Reset reload event for next use
 		windows.ResetEvent(reload)
 		return "reload", nil
+	case windows.WAIT_OBJECT_0 + 2:
+		windows.ResetEvent(maintenance)
+		return "maintenance", nil
 	default:
 		return "", fmt.Errorf("unexpected wait result: %d", event)
 	}
@@ -131,6 +146,14 @@ func createEvents() error {
 		return fmt.Errorf("failed to create reload event: %v", err)
 	}
 
+	maintenanceName, _ := windows.UTF16PtrFromString(eventMaintenance)
+	maintenanceEvent, err = windows.CreateEvent(nil, true, false, maintenanceName)
+	if err != nil {
+		windows.CloseHandle(stopEvent)
+		windows.CloseHandle(reloadEvent)
+		return fmt.Errorf("failed to create maintenance event: %v", err)
+	}
+
 	return nil
 }
 
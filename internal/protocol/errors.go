@@ -0,0 +1,27 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrMalformedPacket is matched by errors caused by invalid data from the peer, as opposed
+// to errors from the connection itself. Use errors.Is to check for it.
+var ErrMalformedPacket = errors.New("malformed packet")
+
+type malformedError struct {
+	err error
+}
+
+func (e *malformedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *malformedError) Unwrap() []error {
+	return []error{ErrMalformedPacket, e.err}
+}
+
+// malformed formats an error that matches ErrMalformedPacket and keeps the message unchanged.
+func malformed(format string, args ...any) error {
+	return &malformedError{err: fmt.Errorf(format, args...)}
+}
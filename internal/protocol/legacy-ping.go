@@ -0,0 +1,241 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	legacyPingID       = 0xFE
+	legacyPingPayload  = 0x01
+	legacyPluginID     = 0xFA
+	legacyKickID       = 0xFF
+	legacyPingChannel  = "MC|PingHost"
+	maxLegacyChannel   = 32
+	maxLegacyPluginLen = 2 + 1 + 2 + 255*2 + 4
+)
+
+// legacyPingHostPrefix starts every 1.6 ping: packet ID, payload, plugin message ID and the
+// MC|PingHost channel name.
+var legacyPingHostPrefix = func() []byte {
+	units := utf16.Encode([]rune(legacyPingChannel))
+	prefix := []byte{legacyPingID, legacyPingPayload, legacyPluginID}
+	prefix = binary.BigEndian.AppendUint16(prefix, uint16(len(units)))
+	for _, unit := range units {
+		prefix = binary.BigEndian.AppendUint16(prefix, unit)
+	}
+	return prefix
+}()
+
+// LegacyPingFormat identifies which pre-1.7 client generation sent a legacy ping.
+type LegacyPingFormat int
+
+const (
+	// LegacyPingBeta is a bare 0xFE sent by Beta 1.8 to 1.3 clients.
+	LegacyPingBeta LegacyPingFormat = iota
+	// LegacyPing14 is 0xFE 0x01 sent by 1.4 and 1.5 clients.
+	LegacyPing14
+	// LegacyPing16 is 0xFE 0x01 0xFA followed by an MC|PingHost plugin message, sent by 1.6 clients.
+	LegacyPing16
+)
+
+// LegacyPing is a server list ping in the format used before 1.7.
+type LegacyPing struct {
+	Format          LegacyPingFormat
+	ProtocolVersion int32
+	Host            string
+	Port            uint16
+}
+
+// LegacyStatus is the information returned in a legacy kick-string response.
+type LegacyStatus struct {
+	ProtocolVersion int32
+	VersionName     string
+	MOTD            string
+	Online          int
+	Max             int
+}
+
+// IsLegacyPing reports whether the next packet is a legacy ping rather than a handshake. Handshakes
+// whose VarInt length has 0x7E as its low bits also start with 0xFE, so the bytes after it decide,
+// the way the vanilla server tells them apart: nothing for Beta clients, 0x01 alone for 1.4 clients
+// and 0x01 0xFA with the MC|PingHost channel for 1.6 clients. Anything else is left to ParseHandshake.
+//
+// Legacy clients send their ping at once and wait for the answer, so a read that runs into its
+// deadline after the first byte means the client has nothing more to send. wait is called once
+// the first byte is 0xFE, callers use it to shorten the read deadline of the connection.
+func IsLegacyPing(reader *bufio.Reader, wait func()) (bool, error) {
+	b, err := reader.Peek(1)
+	if err != nil {
+		return false, err
+	}
+	if b[0] != legacyPingID {
+		return false, nil
+	}
+	wait()
+
+	b, err = reader.Peek(2)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if b[1] != legacyPingPayload {
+		return false, nil
+	}
+
+	b, err = reader.Peek(3)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if b[2] != legacyPluginID {
+		return false, nil
+	}
+
+	// The channel name is a UTF-16 string with a length prefix
+	b, err = reader.Peek(len(legacyPingHostPrefix))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(b, legacyPingHostPrefix), nil
+}
+
+// ParseLegacyPing reads a legacy ping and returns it together with the raw bytes consumed. The
+// ping must have been recognised by IsLegacyPing, the bytes it buffered decide the format.
+func ParseLegacyPing(reader *bufio.Reader) (*LegacyPing, []byte, error) {
+	var data bytes.Buffer
+	r := io.TeeReader(reader, &data)
+
+	id, err := readByte(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read packet ID: %w", err)
+	}
+	if id != legacyPingID {
+		return nil, nil, malformed("unexpected packet ID 0x%02x, expected legacy ping", id)
+	}
+
+	// Beta clients send nothing after the packet ID and wait for the response
+	ping := &LegacyPing{Format: LegacyPingBeta}
+	if reader.Buffered() == 0 {
+		return ping, data.Bytes(), nil
+	}
+
+	payload, err := readByte(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read ping payload: %w", err)
+	}
+	if payload != legacyPingPayload {
+		return nil, nil, malformed("unexpected legacy ping payload 0x%02x", payload)
+	}
+	ping.Format = LegacyPing14
+	if reader.Buffered() == 0 {
+		return ping, data.Bytes(), nil
+	}
+	if next, err := reader.Peek(1); err != nil || next[0] != legacyPluginID {
+		return nil, nil, malformed("unexpected data after legacy ping payload")
+	}
+
+	// 1.6 clients append an MC|PingHost plugin message
+	ping.Format = LegacyPing16
+	if _, err := readByte(r); err != nil {
+		return nil, nil, fmt.Errorf("failed to read plugin message ID: %w", err)
+	}
+	channel, err := readUTF16String(r, maxLegacyChannel)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read plugin channel: %w", err)
+	}
+	if channel != legacyPingChannel {
+		return nil, nil, malformed("unexpected plugin channel %q", channel)
+	}
+	var pluginLen uint16
+	if err := binary.Read(r, binary.BigEndian, &pluginLen); err != nil {
+		return nil, nil, fmt.Errorf("failed to read plugin data length: %w", err)
+	}
+	if pluginLen > maxLegacyPluginLen {
+		return nil, nil, malformed("invalid plugin data length: %d (must be 0-%d)", pluginLen, maxLegacyPluginLen)
+	}
+	plugin := make([]byte, pluginLen)
+	if _, err := io.ReadFull(r, plugin); err != nil {
+		return nil, nil, fmt.Errorf("failed to read plugin data: %w", err)
+	}
+
+	buf := bytes.NewReader(plugin)
+	protoVer, err := buf.ReadByte()
+	if err != nil {
+		return nil, nil, malformed("failed to read protocol version: %w", err)
+	}
+	host, err := readUTF16String(buf, 255)
+	if err != nil {
+		return nil, nil, malformed("failed to read host: %w", err)
+	}
+	var port int32
+	if err := binary.Read(buf, binary.BigEndian, &port); err != nil {
+		return nil, nil, malformed("failed to read port: %w", err)
+	}
+	ping.ProtocolVersion = int32(protoVer)
+	ping.Host = host
+	ping.Port = uint16(port)
+
+	return ping, data.Bytes(), nil
+}
+
+// WriteLegacyKick writes the kick packet legacy clients expect in response to a ping.
+func WriteLegacyKick(w io.Writer, ping *LegacyPing, status LegacyStatus) error {
+	var message string
+	if ping.Format == LegacyPingBeta {
+		motd := strings.ReplaceAll(status.MOTD, "§", "")
+		message = motd + "§" + strconv.Itoa(status.Online) + "§" + strconv.Itoa(status.Max)
+	} else {
+		message = strings.Join([]string{
+			"§1",
+			strconv.Itoa(int(status.ProtocolVersion)),
+			status.VersionName,
+			status.MOTD,
+			strconv.Itoa(status.Online),
+			strconv.Itoa(status.Max),
+		}, "\x00")
+	}
+
+	units := utf16.Encode([]rune(message))
+	var buf bytes.Buffer
+	buf.WriteByte(legacyKickID)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(units)))
+	_ = binary.Write(&buf, binary.BigEndian, units)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readByte(r io.Reader) (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func readUTF16String(r io.Reader, maxLength uint16) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if length > maxLength {
+		return "", malformed("invalid string length: %d (must be 0-%d)", length, maxLength)
+	}
+	units := make([]uint16, length)
+	if err := binary.Read(r, binary.BigEndian, units); err != nil {
+		return "", err
+	}
+	return string(utf16.Decode(units)), nil
+}
@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// legacyPing16 returns the ping a 1.6 client sends for host.
+func legacyPing16(host string) []byte {
+	var plugin bytes.Buffer
+	plugin.WriteByte(78)
+	writeUTF16(&plugin, host)
+	plugin.Write([]byte{0, 0, 0x63, 0xdd})
+
+	ping := bytes.NewBuffer([]byte{legacyPingID, legacyPingPayload, legacyPluginID})
+	writeUTF16(ping, legacyPingChannel)
+	ping.Write([]byte{byte(plugin.Len() >> 8), byte(plugin.Len())})
+	ping.Write(plugin.Bytes())
+	return ping.Bytes()
+}
+
+func writeUTF16(buf *bytes.Buffer, s string) {
+	buf.Write([]byte{0, byte(len(s))})
+	for _, c := range s {
+		buf.Write([]byte{0, byte(c)})
+	}
+}
+
+// sendLegacy writes the fragments to a pipe with a pause before each but the first and returns
+// a reader of the other end whose deadline is shortened the way the gateway does.
+func sendLegacy(t *testing.T, fragments ...[]byte) (*bufio.Reader, func()) {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	go func() {
+		for i, fragment := range fragments {
+			if i > 0 {
+				time.Sleep(50 * time.Millisecond)
+			}
+			if _, err := client.Write(fragment); err != nil {
+				return
+			}
+		}
+	}()
+	_ = server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	wait := func() { _ = server.SetReadDeadline(time.Now().Add(200 * time.Millisecond)) }
+	return bufio.NewReader(server), wait
+}
+
+func TestLegacyPingFragmented(t *testing.T) {
+	tests := []struct {
+		name      string
+		fragments [][]byte
+		format    LegacyPingFormat
+		host      string
+	}{
+		{"beta", [][]byte{{0xFE}}, LegacyPingBeta, ""},
+		{"1.4 split", [][]byte{{0xFE}, {0x01}}, LegacyPing14, ""},
+		{"1.6 split after payload", [][]byte{{0xFE, 0x01}, legacyPing16("mc.example.com")[2:]}, LegacyPing16, "mc.example.com"},
+		{"1.6 split in channel", [][]byte{legacyPing16("mc.example.com")[:8], legacyPing16("mc.example.com")[8:]}, LegacyPing16, "mc.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, wait := sendLegacy(t, tt.fragments...)
+			legacy, err := IsLegacyPing(reader, wait)
+			if err != nil || !legacy {
+				t.Fatalf("IsLegacyPing() = %t, %v, want true", legacy, err)
+			}
+			ping, _, err := ParseLegacyPing(reader)
+			if err != nil {
+				t.Fatalf("ParseLegacyPing() = %v", err)
+			}
+			if ping.Format != tt.format || ping.Host != tt.host {
+				t.Fatalf("ParseLegacyPing() = %+v, want format %d and host %q", ping, tt.format, tt.host)
+			}
+		})
+	}
+}
+
+func TestLegacyPingHandshakeLength254(t *testing.T) {
+	var data []byte
+	for n := 200; n < 256; n++ {
+		data = handshakeSeed(handshakeID, strings.Repeat("a", n), nextStateLogin)
+		if data[0] == 0xFE && data[1] == 0x01 {
+			break
+		}
+	}
+	if data[0] != 0xFE || data[1] != 0x01 {
+		t.Fatal("no handshake of length 254 found")
+	}
+
+	// Split after the length, as if the rest of the handshake was still on its way
+	reader, wait := sendLegacy(t, data[:2], data[2:])
+	legacy, err := IsLegacyPing(reader, wait)
+	if err != nil || legacy {
+		t.Fatalf("IsLegacyPing() = %t, %v, want false", legacy, err)
+	}
+	if _, _, err := ParseHandshake(reader); err != nil {
+		t.Fatalf("ParseHandshake() = %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+)
+
+const (
+	loginStartID = 0x00
+
+	maxUsernameLength = 16
+	// Login start carries at most a username, a UUID and the 1.19 chat signing key and signature
+	maxLoginStartLength = 8192
+	maxPublicKeyLength  = 512
+	maxSignatureLength  = 4096
+
+	// Protocol versions that changed the login start packet layout
+	protocol1_19   = 759
+	protocol1_19_1 = 760
+	protocol1_19_3 = 761
+	protocol1_20_2 = 764
+)
+
+// UUID is a player UUID.
+type UUID [16]byte
+
+// String returns the UUID in its dashed form.
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// Hex returns the UUID as 32 hex digits without dashes, as used in BungeeCord forwarding.
+func (u UUID) Hex() string {
+	return hex.EncodeToString(u[:])
+}
+
+// OfflineUUID returns the UUID an offline-mode server assigns to the given username.
+func OfflineUUID(username string) UUID {
+	uuid := UUID(md5.Sum([]byte("OfflinePlayer:" + username)))
+	uuid[6] = uuid[6]&0x0f | 0x30 // version 3
+	uuid[8] = uuid[8]&0x3f | 0x80 // IETF variant
+	return uuid
+}
+
+// LoginStartPacket is the first packet a client sends in the login state.
+type LoginStartPacket struct {
+	Name string
+	// UUID is the profile UUID sent by 1.19.1 and newer clients, nil when absent.
+	UUID *UUID
+}
+
+// ParseLoginStart reads a login start packet for the given protocol version and returns it
+// together with the raw packet bytes. A packet that is not a login start this parser understands
+// is returned with ErrMalformedPacket and the bytes consumed, the full packet or its length
+// prefix when the length is out of range, so callers that can do without the login may forward
+// them as they are.
+func ParseLoginStart(reader *bufio.Reader, protocolVersion int32) (*LoginStartPacket, []byte, error) {
+	raw, body, err := readRawPacket(reader, maxLoginStartLength)
+	if err != nil {
+		return nil, raw, err
+	}
+	buf := bytes.NewReader(body)
+	packetID, err := readVarInt(buf)
+	if err != nil {
+		return nil, raw, malformed("failed to read packet ID: %w", err)
+	}
+	if packetID != loginStartID {
+		return nil, raw, malformed("unexpected packet ID 0x%02x, expected login start", packetID)
+	}
+	name, err := readString(buf, maxUsernameLength)
+	if err != nil {
+		return nil, raw, malformed("failed to read username: %w", err)
+	}
+	login := &LoginStartPacket{Name: name}
+
+	// The fields after the username changed between versions, a layout we do not
+	// understand only costs us the UUID since the raw packet is forwarded as is
+	if uuid, err := readLoginUUID(buf, protocolVersion); err == nil {
+		login.UUID = uuid
+	}
+
+	return login, raw, nil
+}
+
+// readLoginUUID reads the optional fields following the username and returns the profile UUID if present.
+func readLoginUUID(buf *bytes.Reader, protocolVersion int32) (*UUID, error) {
+	if protocolVersion < protocol1_19 {
+		return nil, nil
+	}
+	if protocolVersion >= protocol1_20_2 {
+		return readUUID(buf)
+	}
+
+	// 1.19 to 1.19.2 send the chat signing key first
+	if protocolVersion < protocol1_19_3 {
+		hasSigData, err := buf.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if hasSigData != 0 {
+			var expiresAt int64
+			if err := binary.Read(buf, binary.BigEndian, &expiresAt); err != nil {
+				return nil, err
+			}
+			if err := skipByteArray(buf, maxPublicKeyLength); err != nil {
+				return nil, err
+			}
+			if err := skipByteArray(buf, maxSignatureLength); err != nil {
+				return nil, err
+			}
+		}
+		if protocolVersion < protocol1_19_1 {
+			return nil, nil
+		}
+	}
+
+	hasUUID, err := buf.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if hasUUID == 0 {
+		return nil, nil
+	}
+	return readUUID(buf)
+}
+
+func readUUID(r io.Reader) (*UUID, error) {
+	var uuid UUID
+	if _, err := io.ReadFull(r, uuid[:]); err != nil {
+		return nil, err
+	}
+	return &uuid, nil
+}
+
+func skipByteArray(buf *bytes.Reader, maxLength int32) error {
+	length, err := readVarInt(buf)
+	if err != nil {
+		return err
+	}
+	if length < 0 || length > maxLength {
+		return malformed("invalid byte array length: %d (must be 0-%d)", length, maxLength)
+	}
+	_, err = buf.Seek(int64(length), io.SeekCurrent)
+	return err
+}
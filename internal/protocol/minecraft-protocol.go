@@ -6,6 +6,21 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"strings"
+)
+
+const (
+	handshakeID = 0x00
+
+	nextStateStatus   = 1
+	nextStateLogin    = 2
+	nextStateTransfer = 3
+
+	// maxAddressChars is the server address limit enforced by vanilla servers
+	maxAddressChars = 255
+	// maxHandshakeLength is the largest valid handshake: packet ID, protocol version,
+	// server address with its length prefix, port and next state
+	maxHandshakeLength = 1 + 5 + 3 + maxAddressChars*3 + 2 + 5
 )
 
 type VarInt int32
@@ -16,6 +31,53 @@ type HandshakePacket struct {
 	ServerAddress   string
 	ServerPort      uint16
 	NextState       VarInt
+
+	// Host is ServerAddress up to the first NUL byte.
+	Host string
+	// AddressSuffix is everything from the first NUL byte of ServerAddress onwards, kept verbatim.
+	AddressSuffix string
+	// ForgeMarker is the mod loader marker found in AddressSuffix, such as FML, FML2 or FML3.
+	ForgeMarker string
+}
+
+var forgeMarkers = map[string]bool{
+	"FML":   true,
+	"FML2":  true,
+	"FML3":  true,
+	"FORGE": true,
+}
+
+// IsModded reports whether the client announced a mod loader in the server address.
+func (h *HandshakePacket) IsModded() bool {
+	return h.ForgeMarker != ""
+}
+
+// Encode serializes the handshake as a length-prefixed packet using the current field values.
+func (h *HandshakePacket) Encode() []byte {
+	var body bytes.Buffer
+	writeVarInt(&body, int32(h.PacketID))
+	writeVarInt(&body, int32(h.ProtocolVersion))
+	writeString(&body, h.ServerAddress)
+	_ = binary.Write(&body, binary.BigEndian, h.ServerPort)
+	writeVarInt(&body, int32(h.NextState))
+
+	return append(encodeVarInt(int32(body.Len())), body.Bytes()...)
+}
+
+// splitServerAddress separates the host from NUL-separated data appended by mod loaders or proxies.
+func splitServerAddress(serverAddr string) (host, suffix, forgeMarker string) {
+	idx := strings.IndexByte(serverAddr, '\x00')
+	if idx == -1 {
+		return serverAddr, "", ""
+	}
+	host, suffix = serverAddr[:idx], serverAddr[idx:]
+	for _, field := range strings.Split(suffix[1:], "\x00") {
+		if forgeMarkers[field] {
+			forgeMarker = field
+			break
+		}
+	}
+	return host, suffix, forgeMarker
 }
 
 func readVarInt(r io.ByteReader) (int32, error) {
@@ -23,7 +85,7 @@ func readVarInt(r io.ByteReader) (int32, error) {
 	var result int32
 	for {
 		if numRead >= 5 {
-			return 0, fmt.Errorf("too many values read")
+			return 0, malformed("too many values read")
 		}
 		b, err := r.ReadByte()
 		if err != nil {
@@ -40,7 +102,12 @@ func readVarInt(r io.ByteReader) (int32, error) {
 }
 
 func encodeVarInt(v int32) []byte {
-	var buf []byte
+	return appendVarInt(nil, v)
+}
+
+func appendVarInt(buf []byte, value int32) []byte {
+	// Negative values take five bytes, shifting them as signed would never reach zero
+	v := uint32(value)
 	for {
 		b := byte(v & 0x7F)
 		v >>= 7
@@ -56,63 +123,59 @@ func encodeVarInt(v int32) []byte {
 }
 
 func ParseHandshake(reader *bufio.Reader) (*HandshakePacket, []byte, error) {
-	var data []byte
-	// read packet len
-	packetLen, err := readVarInt(reader)
+	// read the full packet, bounded before allocation
+	data, payload, err := readRawPacket(reader, maxHandshakeLength)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read packet length: %w", err)
-	}
-	// read full packet
-	payload := make([]byte, packetLen)
-	if _, err := io.ReadFull(reader, payload); err != nil {
-		return nil, nil, fmt.Errorf("failed to read full packet: %w", err)
+		return nil, nil, err
 	}
 	// prepare to parse handshake packet
 	buf := bytes.NewReader(payload)
 	// packet ID
 	packetID, err := readVarInt(buf)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read packet ID: %w", err)
+		return nil, nil, malformed("failed to read packet ID: %w", err)
+	}
+	if packetID != handshakeID {
+		return nil, nil, malformed("unexpected packet ID 0x%02x, expected handshake", packetID)
 	}
 	// protocol version
 	protoVer, err := readVarInt(buf)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read protocol version: %w", err)
+		return nil, nil, malformed("failed to read protocol version: %w", err)
 	}
 	// server address
-	addrLen, err := readVarInt(buf)
+	serverAddr, err := readString(buf, maxAddressChars)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read address length: %w", err)
-	}
-	// validate address length to prevent memory exhaustion
-	const maxAddressLength = 65535 // reasonable limit for domain names
-	if addrLen < 0 || addrLen > maxAddressLength {
-		return nil, nil, fmt.Errorf("invalid address length: %d (must be 0-%d)", addrLen, maxAddressLength)
+		return nil, nil, fmt.Errorf("failed to read server address: %w", err)
 	}
-	addrBytes := make([]byte, addrLen)
-	if _, err := io.ReadFull(buf, addrBytes); err != nil {
-		return nil, nil, fmt.Errorf("failed to read address: %w", err)
-	}
-	serverAddr := string(addrBytes)
 	// server port
 	var serverPort uint16
 	if err := binary.Read(buf, binary.BigEndian, &serverPort); err != nil {
-		return nil, nil, fmt.Errorf("failed to read server port: %w", err)
+		return nil, nil, malformed("failed to read server port: %w", err)
 	}
 	// next state
 	nextState, err := readVarInt(buf)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read next state: %w", err)
+		return nil, nil, malformed("failed to read next state: %w", err)
+	}
+	switch nextState {
+	case nextStateStatus, nextStateLogin, nextStateTransfer:
+	default:
+		return nil, nil, malformed("unknown next state: %d", nextState)
 	}
 
+	host, suffix, forgeMarker := splitServerAddress(serverAddr)
+
 	h := &HandshakePacket{
 		PacketID:        VarInt(packetID),
 		ProtocolVersion: VarInt(protoVer),
 		ServerAddress:   serverAddr,
 		ServerPort:      serverPort,
 		NextState:       VarInt(nextState),
+		Host:            host,
+		AddressSuffix:   suffix,
+		ForgeMarker:     forgeMarker,
 	}
 
-	data = append(encodeVarInt(packetLen), payload...)
 	return h, data, nil
 }
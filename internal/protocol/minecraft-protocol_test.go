@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func handshakeSeed(packetID int32, address string, nextState int32) []byte {
+	h := &HandshakePacket{
+		PacketID:        VarInt(packetID),
+		ProtocolVersion: 767,
+		ServerAddress:   address,
+		ServerPort:      25565,
+		NextState:       VarInt(nextState),
+	}
+	return h.Encode()
+}
+
+func FuzzParseHandshake(f *testing.F) {
+	f.Add(handshakeSeed(handshakeID, "mc.example.com", nextStateLogin))
+	f.Add(handshakeSeed(handshakeID, "mc.example.com\x00FML3\x00", nextStateStatus))
+	// Negative length and a length of 2^31-1
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0x00})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0x07, 0x00})
+	f.Add(handshakeSeed(handshakeID, strings.Repeat("a", 256), nextStateLogin))
+	f.Add(handshakeSeed(0x01, "mc.example.com", nextStateLogin))
+	f.Add(handshakeSeed(handshakeID, "mc.example.com", 0))
+	f.Add(handshakeSeed(handshakeID, "mc.example.com", 4))
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		h, data, err := ParseHandshake(bufio.NewReader(bytes.NewReader(input)))
+		if err != nil {
+			return
+		}
+		encoded := h.Encode()
+		if bytes.Equal(encoded, data) {
+			return
+		}
+		// Overlong VarInts and data after the next state are accepted but not reproduced, so
+		// the encoding may only be shorter and must parse back to the same handshake
+		if len(encoded) >= len(data) {
+			t.Fatalf("Encode() = %x, parsed from %x", encoded, data)
+		}
+		again, _, err := ParseHandshake(bufio.NewReader(bytes.NewReader(encoded)))
+		if err != nil {
+			t.Fatalf("failed to parse encoded handshake %x: %v", encoded, err)
+		}
+		if *again != *h {
+			t.Fatalf("handshake changed after encoding: %+v, was %+v", again, h)
+		}
+	})
+}
+
+func FuzzReadVarInt(f *testing.F) {
+	f.Add([]byte{0x00})
+	f.Add([]byte{0xac, 0x02})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0x0f})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0x07})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	f.Add([]byte{0x80})
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		r := bytes.NewReader(input)
+		value, err := readVarInt(r)
+		if err != nil {
+			return
+		}
+		read := len(input) - r.Len()
+		encoded := encodeVarInt(value)
+		if len(encoded) > read {
+			t.Fatalf("encodeVarInt(%d) = %x, longer than the %d bytes read", value, encoded, read)
+		}
+		decoded, err := readVarInt(bytes.NewReader(encoded))
+		if err != nil || decoded != value {
+			t.Fatalf("readVarInt(%x) = %d, %v, want %d", encoded, decoded, err, value)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	// maxStatusPacketLength bounds packets read during the status exchange.
+	maxStatusPacketLength = 1024
+
+	maxVarIntLength = 5
+)
+
+func writeVarInt(buf *bytes.Buffer, v int32) {
+	buf.Write(encodeVarInt(v))
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeVarInt(buf, int32(len(s)))
+	buf.WriteString(s)
+}
+
+// WritePacket writes an uncompressed packet with the given ID and payload.
+func WritePacket(w io.Writer, packetID int32, payload []byte) error {
+	var body bytes.Buffer
+	writeVarInt(&body, packetID)
+	body.Write(payload)
+
+	var packet bytes.Buffer
+	writeVarInt(&packet, int32(body.Len()))
+	packet.Write(body.Bytes())
+	_, err := w.Write(packet.Bytes())
+	return err
+}
+
+// readString reads a length-prefixed UTF-8 string of at most maxChars characters.
+func readString(r *bytes.Reader, maxChars int) (string, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return "", malformed("failed to read string length: %w", err)
+	}
+	// Each character takes at most 3 bytes in the encoding the game uses
+	if length < 0 || int(length) > maxChars*3 {
+		return "", malformed("invalid string length: %d (must be 0-%d)", length, maxChars*3)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", malformed("failed to read string: %w", err)
+	}
+	if count := utf8.RuneCount(data); count > maxChars {
+		return "", malformed("string too long: %d characters (must be 0-%d)", count, maxChars)
+	}
+	return string(data), nil
+}
+
+// readRawPacket reads an uncompressed packet and returns it with its length prefix, together
+// with the body following the prefix. Both share a single allocation. On an out of range length
+// raw holds the length prefix alone, it is all that was consumed.
+func readRawPacket(reader *bufio.Reader, maxLength int32) (raw, body []byte, err error) {
+	packetLen, err := readVarInt(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read packet length: %w", err)
+	}
+	if packetLen <= 0 || packetLen > maxLength {
+		return appendVarInt(nil, packetLen), nil, malformed("invalid packet length: %d (must be 1-%d)", packetLen, maxLength)
+	}
+	raw = appendVarInt(make([]byte, 0, maxVarIntLength+int(packetLen)), packetLen)
+	prefixLen := len(raw)
+	raw = raw[:prefixLen+int(packetLen)]
+	if _, err := io.ReadFull(reader, raw[prefixLen:]); err != nil {
+		return nil, nil, fmt.Errorf("failed to read full packet: %w", err)
+	}
+	return raw, raw[prefixLen:], nil
+}
+
+// ReadPacket reads an uncompressed packet and returns its ID and payload.
+func ReadPacket(reader *bufio.Reader, maxLength int32) (int32, []byte, error) {
+	_, body, err := readRawPacket(reader, maxLength)
+	if err != nil {
+		return 0, nil, err
+	}
+	buf := bytes.NewReader(body)
+	packetID, err := readVarInt(buf)
+	if err != nil {
+		return 0, nil, malformed("failed to read packet ID: %w", err)
+	}
+	return packetID, body[len(body)-buf.Len():], nil
+}
@@ -2,7 +2,9 @@ package protocol
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 
 	proxyproto "github.com/pires/go-proxyproto"
@@ -18,7 +20,12 @@ type ProxyProtocolHeader struct {
 func ParseProxyProtocol(reader *bufio.Reader) (*ProxyProtocolHeader, error) {
 	header, err := proxyproto.Read(reader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse proxy protocol: %w", err)
+		// Anything but a failed read means the peer sent an invalid header
+		var netErr net.Error
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+			return nil, fmt.Errorf("failed to parse proxy protocol: %w", err)
+		}
+		return nil, malformed("failed to parse proxy protocol: %w", err)
 	}
 
 	return &ProxyProtocolHeader{
@@ -28,19 +35,26 @@ func ParseProxyProtocol(reader *bufio.Reader) (*ProxyProtocolHeader, error) {
 }
 
 // BuildProxyProtocolV1Header builds a PROXY protocol v1 header for sending to upstream.
+// A destination that is not TCP, such as a Unix socket, is sent as the unspecified address
+// of the source family since v1 headers only carry TCP addresses. A source that is not TCP,
+// such as a client on a Unix listener, is sent as UNKNOWN and the backend uses the real
+// connection address instead.
 func BuildProxyProtocolV1Header(srcAddr, dstAddr net.Addr) ([]byte, error) {
 	srcTCP, ok := srcAddr.(*net.TCPAddr)
 	if !ok {
-		return nil, fmt.Errorf("source address is not TCP: %T", srcAddr)
-	}
-	dstTCP, ok := dstAddr.(*net.TCPAddr)
-	if !ok {
-		return nil, fmt.Errorf("destination address is not TCP: %T", dstAddr)
+		return []byte("PROXY UNKNOWN\r\n"), nil
 	}
 
 	transportProto := proxyproto.TCPv4
+	unspecified := net.IPv4zero
 	if srcTCP.IP.To4() == nil {
 		transportProto = proxyproto.TCPv6
+		unspecified = net.IPv6unspecified
+	}
+
+	dstTCP, ok := dstAddr.(*net.TCPAddr)
+	if !ok {
+		dstTCP = &net.TCPAddr{IP: unspecified}
 	}
 
 	header := &proxyproto.Header{
@@ -0,0 +1,160 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+const (
+	statusRequestID  = 0x00
+	statusResponseID = 0x00
+	pingRequestID    = 0x01
+	pongResponseID   = 0x01
+
+	loginDisconnectID = 0x00
+
+	// maxStatusJSONChars is the longest status response string accepted from a backend
+	maxStatusJSONChars = 32767
+	// maxStatusResponseLength bounds the status response packet read from a backend
+	maxStatusResponseLength = 1 + maxVarIntLength + maxStatusJSONChars*3
+)
+
+// StatusVersion is the version section of a status response.
+type StatusVersion struct {
+	Name     string `json:"name"`
+	Protocol int32  `json:"protocol"`
+}
+
+// StatusPlayers is the players section of a status response.
+type StatusPlayers struct {
+	Max    int                  `json:"max"`
+	Online int                  `json:"online"`
+	Sample []StatusPlayerSample `json:"sample,omitempty"`
+}
+
+// StatusPlayerSample is a player listed in the hover text of the player count.
+type StatusPlayerSample struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// StatusResponse is the JSON document returned for a server list ping.
+type StatusResponse struct {
+	Version     StatusVersion   `json:"version"`
+	Players     *StatusPlayers  `json:"players,omitempty"`
+	Description json.RawMessage `json:"description,omitempty"`
+	Favicon     string          `json:"favicon,omitempty"`
+}
+
+// TextComponent returns a plain chat component containing the given text.
+func TextComponent(text string) json.RawMessage {
+	data, _ := json.Marshal(struct {
+		Text string `json:"text"`
+	}{Text: text})
+	return data
+}
+
+// ServeStatus answers the status request and optional ping that follow a handshake with next state 1.
+func ServeStatus(reader *bufio.Reader, w io.Writer, status *StatusResponse) error {
+	body, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to encode status response: %w", err)
+	}
+	return ServeStatusJSON(reader, w, body)
+}
+
+// ServeStatusJSON is like ServeStatus with a response that is already encoded.
+func ServeStatusJSON(reader *bufio.Reader, w io.Writer, body []byte) error {
+	packetID, _, err := ReadPacket(reader, maxStatusPacketLength)
+	if err != nil {
+		return fmt.Errorf("failed to read status request: %w", err)
+	}
+	if packetID != statusRequestID {
+		return malformed("unexpected packet ID 0x%02x, expected status request", packetID)
+	}
+
+	var payload bytes.Buffer
+	writeString(&payload, string(body))
+	if err := WritePacket(w, statusResponseID, payload.Bytes()); err != nil {
+		return fmt.Errorf("failed to write status response: %w", err)
+	}
+
+	// The ping is optional, some clients close right after the response
+	packetID, data, err := ReadPacket(reader, maxStatusPacketLength)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return fmt.Errorf("failed to read ping request: %w", err)
+	}
+	if packetID != pingRequestID {
+		return malformed("unexpected packet ID 0x%02x, expected ping request", packetID)
+	}
+	if err := WritePacket(w, pongResponseID, data); err != nil {
+		return fmt.Errorf("failed to write pong response: %w", err)
+	}
+	return nil
+}
+
+// QueryStatus sends the handshake, which must have next state 1, and a status request to a server
+// and returns the JSON status response it answers with.
+func QueryStatus(rw io.ReadWriter, handshake []byte) ([]byte, error) {
+	request := append(slices.Clip(handshake), encodeVarInt(1)...)
+	request = append(request, statusRequestID)
+	if _, err := rw.Write(request); err != nil {
+		return nil, fmt.Errorf("failed to write status request: %w", err)
+	}
+
+	packetID, data, err := ReadPacket(bufio.NewReader(rw), maxStatusResponseLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status response: %w", err)
+	}
+	if packetID != statusResponseID {
+		return nil, malformed("unexpected packet ID 0x%02x, expected status response", packetID)
+	}
+	body, err := readString(bytes.NewReader(data), maxStatusJSONChars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status response: %w", err)
+	}
+	if !json.Valid([]byte(body)) {
+		return nil, malformed("status response is not valid JSON")
+	}
+	return []byte(body), nil
+}
+
+// RewriteStatusProtocol returns the status response with its version protocol replaced, so that
+// clients of any version see the server as compatible. Other fields are kept as they are.
+func RewriteStatusProtocol(body []byte, protocolVersion int32) ([]byte, error) {
+	var status map[string]json.RawMessage
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, fmt.Errorf("failed to decode status response: %w", err)
+	}
+	var version map[string]json.RawMessage
+	if raw, ok := status["version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, fmt.Errorf("failed to decode status version: %w", err)
+		}
+	}
+	if version == nil {
+		version = make(map[string]json.RawMessage)
+	}
+	version["protocol"] = json.RawMessage(strconv.Itoa(int(protocolVersion)))
+	var err error
+	if status["version"], err = json.Marshal(version); err != nil {
+		return nil, err
+	}
+	return json.Marshal(status)
+}
+
+// WriteLoginDisconnect sends a login disconnect packet with the given message.
+func WriteLoginDisconnect(w io.Writer, message string) error {
+	var payload bytes.Buffer
+	writeString(&payload, string(TextComponent(message)))
+	return WritePacket(w, loginDisconnectID, payload.Bytes())
+}
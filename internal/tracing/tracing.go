@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+
+	defaultServiceName = "minecraft-gateway"
+)
+
+// Options configures trace export.
+type Options struct {
+	Enabled  bool
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector address, such as localhost:4318.
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the fraction of traces sampled, 0 samples none.
+	SampleRatio float64
+	ServiceName string
+}
+
+// ShutdownFunc flushes pending spans and stops the exporter.
+type ShutdownFunc func(ctx context.Context) error
+
+// Setup installs a global tracer provider for the given options. When tracing is disabled
+// a no-op provider is installed so spans cost next to nothing.
+func Setup(ctx context.Context, opts Options) (ShutdownFunc, error) {
+	provider, shutdown, err := New(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	Install(provider)
+	return shutdown, nil
+}
+
+// Install makes provider the global tracer provider.
+func Install(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+}
+
+// New returns the tracer provider for the given options without installing it, see Setup.
+func New(ctx context.Context, opts Options) (trace.TracerProvider, ShutdownFunc, error) {
+	if !opts.Enabled {
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(opts.Exporter) {
+	case "", ExporterOTLP:
+		clientOpts := []otlptracehttp.Option{}
+		if opts.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	provider := NewProvider(exporter, opts)
+	return provider, provider.Shutdown, nil
+}
+
+// NewProvider returns a tracer provider exporting to the given exporter. Tests can pass an
+// in-memory exporter from go.opentelemetry.io/otel/sdk/trace/tracetest.
+func NewProvider(exporter sdktrace.SpanExporter, opts Options) *sdktrace.TracerProvider {
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	ratio := opts.SampleRatio
+	if ratio < 0 || ratio > 1 {
+		ratio = 1
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+}
+
+// Tracer returns the tracer of the currently installed provider.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
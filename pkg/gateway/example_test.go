@@ -0,0 +1,79 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/SmallL-U/minecraft-gateway/pkg/gateway"
+)
+
+// A gateway built in code with a custom router, serving a listener of the embedding program.
+func Example() {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer backend.Close()
+
+	conf := &gateway.Config{
+		ListenAddr: "127.0.0.1:0",
+		Whitelist:  []string{"127.0.0.0/8"},
+	}
+	gw, err := gateway.New(conf)
+	if err != nil {
+		panic(err)
+	}
+	gw.SetRouter(gateway.RouterFunc(func(ctx context.Context, req *gateway.RouteRequest) (gateway.Decision, error) {
+		if req.Handshake.Host != "lobby.example.com" {
+			return gateway.Decision{Drop: true}, nil
+		}
+		return gateway.Decision{Backend: backend.Addr().String()}, nil
+	}))
+	closed := make(chan gateway.SessionInfo, 1)
+	gw.Use(gateway.Hooks{OnClose: func(info gateway.SessionInfo) { closed <- info }})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go gw.Serve(context.Background(), listener)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = gw.Shutdown(ctx)
+	}()
+
+	// A client pings the server list of lobby.example.com through the gateway
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	handshake := &gateway.HandshakePacket{ProtocolVersion: 767, ServerAddress: "lobby.example.com", ServerPort: 25565, NextState: 1}
+	if _, err := client.Write(handshake.Encode()); err != nil {
+		panic(err)
+	}
+
+	conn, err := backend.Accept()
+	if err != nil {
+		panic(err)
+	}
+	received := make([]byte, len(handshake.Encode()))
+	if _, err := io.ReadFull(conn, received); err != nil {
+		panic(err)
+	}
+	fmt.Println("backend received the handshake:", bytes.Equal(received, handshake.Encode()))
+
+	// The gateway passes the hang up of the client on to the backend
+	_ = client.Close()
+	_, _ = io.Copy(io.Discard, conn)
+	_ = conn.Close()
+	info := <-closed
+	fmt.Println("session to", info.ServerName, "closed:", info.CloseReason)
+	// Output:
+	// backend received the handshake: true
+	// session to lobby.example.com closed: client_eof
+}
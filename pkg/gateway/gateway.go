@@ -0,0 +1,108 @@
+// Package gateway embeds the Minecraft gateway in other Go programs.
+//
+// A Gateway is built from a Config, either loaded from a YAML file or filled in by code:
+//
+//	conf := &gateway.Config{
+//		ListenAddr: ":25565",
+//		Default:    "127.0.0.1:25577",
+//		Whitelist:  []string{"0.0.0.0/0", "::/0"},
+//		Servers:    []gateway.Server{{Name: "lobby.example.com", Address: "127.0.0.1:25578"}},
+//	}
+//	gw, err := gateway.New(conf)
+//	if err != nil {
+//		return err
+//	}
+//	gw.SetRouter(gateway.RouterFunc(func(ctx context.Context, req *gateway.RouteRequest) (gateway.Decision, error) {
+//		return gateway.Decision{Backend: lookupBackend(req.Handshake.Host)}, nil
+//	}))
+//	go gw.Serve(ctx, listener)
+//	defer gw.Shutdown(shutdownCtx)
+//
+// Serve returns ErrServerClosed once Shutdown was called. Shutdown interrupts connections still
+// in the handshake phase right away and waits for established sessions until its context is done.
+//
+// Without a custom Router, connections are routed by the servers of the config, see ConfigRouter.
+//
+// The types of this package are aliases of the gateway internals, their methods are:
+//
+//   - Gateway.Serve(ctx, listener) serves connections accepted by listener until Shutdown is
+//     called or ctx is done.
+//   - Gateway.ListenAndServe(ctx) listens on Config.ListenAddr and serves it.
+//   - Gateway.Shutdown(ctx) closes the listeners, interrupts connections that are not proxied yet
+//     and waits for established sessions until ctx is done.
+//   - Gateway.SetRouter(router) and Gateway.Use(hooks) customize routing and observe connections,
+//     both must be called before serving.
+//   - Gateway.UpdateConfig(conf) swaps the config for connections accepted afterwards, conf must
+//     be prepared like New and LoadConfig do.
+//   - Gateway.SetMaintenance(state) turns maintenance of servers on or off by name.
+//   - Router.Route(ctx, req) returns the Decision for a connection. An empty Decision.Backend
+//     rejects it with Decision.Message, Decision.Drop closes it without an answer.
+//   - HandshakePacket.Encode() returns the packet as sent on the wire.
+//
+// The fields of Config and Server follow config.yml, see the README for their meaning.
+package gateway
+
+import (
+	"github.com/SmallL-U/minecraft-gateway/internal/config"
+	"github.com/SmallL-U/minecraft-gateway/internal/gateway"
+	"github.com/SmallL-U/minecraft-gateway/internal/protocol"
+)
+
+type (
+	// Gateway accepts Minecraft connections and proxies them to backends.
+	Gateway = gateway.Gateway
+
+	// Config is the gateway configuration, the same structure as config.yml.
+	Config = config.Config
+	// Server maps a hostname to its backend and per-server settings.
+	Server = config.Server
+	// Route sends clients of a server to another backend by protocol version or mod loader.
+	Route = config.Route
+	// ProxyProtocolConfig controls sending and receiving HAProxy PROXY headers.
+	ProxyProtocolConfig = config.ProxyProtocolConfig
+	// MaintenanceConfig takes a server offline for players while staff can still join.
+	MaintenanceConfig = config.MaintenanceConfig
+	// StatusAggregateConfig answers status pings of a server with the players of all its backends.
+	StatusAggregateConfig = config.StatusAggregateConfig
+
+	// Router picks the backend for a connection once its handshake has been read.
+	Router = gateway.Router
+	// RouterFunc adapts a function to the Router interface.
+	RouterFunc = gateway.RouterFunc
+	// RouteRequest describes a connection waiting for a routing decision.
+	RouteRequest = gateway.RouteRequest
+	// Decision is the outcome of routing a connection.
+	Decision = gateway.Decision
+
+	// Hooks observe and filter connections at accept, handshake, route and close.
+	Hooks = gateway.Hooks
+	// SessionInfo summarizes a closed connection.
+	SessionInfo = gateway.SessionInfo
+
+	// HandshakePacket is the first packet sent by modern clients.
+	HandshakePacket = protocol.HandshakePacket
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown was called.
+var ErrServerClosed = gateway.ErrServerClosed
+
+// New returns a gateway for the given config after filling in defaults and validating it.
+// Unlike a config file, conf may leave out servers and the default backend when a custom
+// Router is set with SetRouter.
+func New(conf *Config) (*Gateway, error) {
+	if err := conf.Prepare(); err != nil {
+		return nil, err
+	}
+	return gateway.NewGateway(conf), nil
+}
+
+// LoadConfig reads and prepares a YAML config file.
+func LoadConfig(filename string) (*Config, error) {
+	return config.LoadConfig(filename)
+}
+
+// ConfigRouter returns the default router, which matches the handshake host against the servers
+// and routes of conf and falls back to its default backend.
+func ConfigRouter(conf *Config) Router {
+	return gateway.ConfigRouter(conf)
+}